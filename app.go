@@ -6,26 +6,43 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/mailgun/log"
 	"github.com/mailgun/metrics"
+	"github.com/mailgun/scroll/trace"
 	"github.com/mailgun/scroll/vulcand"
 	"github.com/pkg/errors"
 )
 
 // Represents an app.
 type App struct {
-	once       *sync.Once
-	Config     AppConfig
-	router     *mux.Router
-	stats      *appStats
-	vulcandReg *vulcand.Registry
-	done       chan struct{}
-	wg         sync.WaitGroup
+	once          *sync.Once
+	Config        AppConfig
+	router        *mux.Router
+	routesMu      sync.Mutex
+	routes        []*appRoute
+	current       atomic.Value
+	published     bool
+	notFound      http.Handler
+	stats         *appStats
+	encoders      *encoderRegistry
+	errors        *errorRegistry
+	middlewares   []HandlerMiddleware
+	requestLogger *requestLogger
+	health        *healthRegistry
+	shuttingDown  int32
+	inFlight      int64
+	startHooks    []Hook
+	shutdownHooks []Hook
+	registrar     Registrar
+	done          chan struct{}
+	wg            sync.WaitGroup
 }
 
 // This is a separate struct because JSON unmarshal() throws errors
@@ -38,6 +55,9 @@ type JSONConfig struct {
 
 	// Retrieved from via etcd
 	VulcandNamespace string `json:"vulcand_namespace"`
+
+	// Key paging cursors are signed with, shared by the instances of the app
+	CursorKey string `json:"cursor_key"`
 }
 
 // Represents a configuration object an app is created with.
@@ -52,23 +72,64 @@ type AppConfig struct {
 	// optional router to use
 	Router *mux.Router
 
-	// host names of the public and protected API entrypoints used for vulcand registration
+	// host names of the public and protected API entrypoints used for vulcand registration,
+	// and their URLs used for making links, e.g. to pages of paged responses
 	PublicAPIHost    string
-	PublicAPIURL     string // NOT USED, included for completeness
+	PublicAPIURL     string
 	ProtectedAPIHost string
 	ProtectedAPIURL  string
 
 	// Vulcand config must be provided to enable registration in etcd.
 	Vulcand *vulcand.Config
 
+	// registrar to publish the app and its handlers with instead of registering in vulcand, e.g.
+	// one of the registrar package
+	Registrar Registrar
+
 	// metrics service used for emitting the app's real-time metrics
 	Client metrics.Client
 
+	// function deciding whether a request replied with the status code succeeded, for the request
+	// stats; DefaultSuccessStatus if not specified
+	SuccessStatus func(status int) bool
+
+	// additional backend receiving the stats of the requests, e.g. PrometheusStats; if it is also
+	// an http.Handler it is served at /_metrics
+	Stats StatsBackend
+
+	// tracer starting a server span for every request served by the app's handlers; it also traces
+	// the vulcand registration unless the vulcand config has a tracer of its own
+	Tracer trace.Tracer
+
+	// key that paging cursors are signed with; it is required to use cursors and has to be the same
+	// for all instances of the app, so that cursors made by one instance are accepted by the others;
+	// if not specified it is taken from the config in etcd if there is one
+	CursorKey []byte
+
+	// structured logging of the requests served by the app's handlers; if not specified
+	// the requests are logged with the LogRequest function
+	RequestLog *RequestLogConfig
+
+	// format of error responses, ErrorFormatMessage if not specified
+	ErrorFormat ErrorFormat
+
+	// base URI of the problem types when ErrorFormat is ErrorFormatProblem, e.g.
+	// "https://docs.example.com/errors"; if not specified problem types are "about:blank"
+	ProblemTypeURI string
+
 	HTTP struct {
 		ReadTimeout  time.Duration
 		WriteTimeout time.Duration
 		IdleTimeout  time.Duration
 	}
+
+	// drain sequence of the app on shutdown: readiness fails, the app is removed from vulcand and,
+	// after DrainDelay to let vulcand stop sending requests to the app, the HTTP server is given
+	// Timeout to finish serving the requests in flight
+	Shutdown struct {
+		DrainDelay time.Duration
+		Timeout    time.Duration
+	}
 }
 
 // Create a new app.
@@ -99,24 +160,45 @@ func NewAppWithConfig(config AppConfig) (*App, error) {
 		app.router = mux.NewRouter()
 		app.router.UseEncodedPath()
 	}
-	app.router.HandleFunc("/_ping", handlePing).Methods("GET")
+	app.addBuiltinRoutes(app.router)
+	app.current.Store(app.router)
+
+	if config.Registrar != nil {
+		app.registrar = config.Registrar
+	} else if config.Vulcand != nil {
+		vulcandConfig := *config.Vulcand
+		if vulcandConfig.Tracer == nil {
+			vulcandConfig.Tracer = config.Tracer
+		}
+		registry, err := vulcand.NewRegistry(vulcandConfig, config.Name, config.ListenIP, config.ListenPort)
+		if err != nil {
+			return nil, err
+		}
+		app.registrar = registry
+	}
 
-	if config.Vulcand != nil {
+	if config.RequestLog != nil {
 		var err error
-		app.vulcandReg, err = vulcand.NewRegistry(*config.Vulcand, config.Name, config.ListenIP, config.ListenPort)
-		if err != nil {
+		if app.requestLogger, err = newRequestLogger(*config.RequestLog); err != nil {
 			return nil, err
 		}
 	}
 
-	app.stats = newAppStats(config.Client)
+	app.health = newHealthRegistry()
+	app.addBuiltinHealthChecks()
+	app.stats = newAppStats(config.Client, config.Stats, config.SuccessStatus)
+	app.encoders = newEncoderRegistry()
+	app.errors = newErrorRegistry(defaultErrors)
 	return &app, nil
 }
 
 // Register a handler function.
 //
 // If vulcan registration is enabled in the both app config and handler spec,
-// the handler will be registered in the local etcd instance.
+// the handler will be registered in the local etcd instance, or published with
+// the registrar of the app if it has one configured.
+//
+// Handlers can be added while the app is running, see RemoveHandler.
 func (app *App) AddHandler(spec Spec) error {
 	var handler http.HandlerFunc
 
@@ -127,31 +209,92 @@ func (app *App) AddHandler(spec Spec) error {
 		handler = MakeHandler(app, spec.Handler, spec)
 	} else if spec.HandlerWithBody != nil {
 		handler = MakeHandlerWithBody(app, spec.HandlerWithBody, spec)
+	} else if spec.JSONHandler != nil {
+		if spec.JSONRequest == nil {
+			return fmt.Errorf("the spec does not provide a JSON request type: %v", spec)
+		}
+		if t := reflect.TypeOf(spec.JSONRequest); t.Kind() != reflect.Struct &&
+			(t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct) {
+			return fmt.Errorf("the spec JSON request type is not a struct: %v", t)
+		}
+		if err := checkValidateTags(reflect.TypeOf(spec.JSONRequest)); err != nil {
+			return err
+		}
+		handler = MakeJSONHandler(app, spec.JSONHandler, spec)
+	} else if spec.BatchHandler != nil {
+		if err := checkBatchItem(spec); err != nil {
+			return err
+		}
+		handler = MakeBatchHandler(app, spec.BatchHandler, spec)
 	} else {
 		return fmt.Errorf("the spec does not provide a handler function: %v", spec)
 	}
 
-	for _, path := range spec.Paths {
-		route := app.router.HandleFunc(path, handler).Methods(spec.Methods...)
-		if len(spec.Headers) != 0 {
-			route.Headers(spec.Headers...)
-		}
-		if app.vulcandReg != nil {
-			app.registerFrontend(spec.Methods, path, spec.Scope, spec.Middlewares)
+	// Frontends are published before the handler is routed, so that if publishing fails the handler
+	// is neither served nor partially published and adding it can be retried.
+	if app.registrar != nil {
+		for i, path := range spec.Paths {
+			if err := app.registerFrontend(spec.Methods, path, spec.Scope, spec.Middlewares); err != nil {
+				// Registrars keep frontends that failed to be written, so the failed one is withdrawn too.
+				for _, published := range spec.Paths[:i+1] {
+					if err := app.deregisterFrontend(spec.Methods, published, spec.Scope); err != nil {
+						log.Errorf("failed to withdraw frontend of %v %v: %v", spec.Methods, published, err)
+					}
+				}
+				return err
+			}
 		}
 	}
 
+	recovered := app.recoverPanics(spec, app.wrapHandler(spec, handler))
+	wrapped := requestIDHandler(app.countInFlight(app.traceRequests(spec, recovered)))
+	for _, path := range spec.Paths {
+		app.addRoute(&appRoute{methods: spec.Methods, path: path, headers: spec.Headers, scope: spec.Scope, handler: wrapped})
+	}
+
 	return nil
 }
 
+// RegisterEncoder makes the app serve responses of handlers in the media type to the requests that
+// accept it. It replaces the encoder registered for the media type before, if any. The media type
+// may have parameters, in which case only requests accepting the media type with the same parameter
+// values will be served by the encoder, e.g. "application/json; pretty=true".
+//
+// The app supports JSON, pretty JSON, MessagePack, CSV, plain text and NDJSON out of the box, with JSON
+// being the default for requests that do not have an Accept header.
+func (app *App) RegisterEncoder(mediaType string, encoder Encoder) error {
+	return app.encoders.register(mediaType, encoder)
+}
+
+// Reply encodes the response with the encoder that best matches the request Accept header and
+// writes it with the provided HTTP status code. If the request does not accept any of the
+// media types supported by the app, replies with 406 Not Acceptable.
+func (app *App) Reply(w http.ResponseWriter, r *http.Request, response interface{}, status int) {
+	encoder, err := app.negotiateEncoder(w, r)
+	if err != nil {
+		encoder = app.encoders.defaultEncoder()
+		response, status = app.errorResponse(w, err)
+	}
+	reply(w, encoder, response, status)
+}
+
 // GetHandler returns HTTP compatible Handler interface.
 func (app *App) GetHandler() http.Handler {
-	return app.router
+	app.routesMu.Lock()
+	defer app.routesMu.Unlock()
+	app.published = true
+	if app.Config.Router != nil {
+		return app.router
+	}
+	return http.HandlerFunc(app.serveHTTP)
 }
 
 // SetNotFoundHandler sets the handler for the case when URL can not be matched by the router.
 func (app *App) SetNotFoundHandler(fn http.HandlerFunc) {
-	app.router.NotFoundHandler = fn
+	app.routesMu.Lock()
+	defer app.routesMu.Unlock()
+	app.notFound = fn
+	app.updateRouter(func(router *mux.Router) { router.NotFoundHandler = fn })
 }
 
 // IsPublicRequest determines whether the provided request came through the public HTTP endpoint.
@@ -163,19 +306,56 @@ func (app *App) IsPublicRequest(request *http.Request) bool {
 //
 // Supports graceful shutdown on 'kill' and 'int' signals.
 func (app *App) Run() error {
-	if app.vulcandReg != nil {
-		err := app.vulcandReg.Start()
-		if err != nil {
-			return fmt.Errorf("failed to start vulcand registry: err=(%s)", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// listen for a shutdown signal
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+	go func() {
+		select {
+		case s := <-signalCh:
+			log.Infof("Got signal %v, shutting down", s)
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	if app.registrar != nil {
 		heartbeatCh := make(chan os.Signal, 1)
 		signal.Notify(heartbeatCh, syscall.SIGUSR1)
 		go func() {
 			sig := <-heartbeatCh
-			log.Infof("Got signal %v, canceling vulcand registration", sig)
-			app.vulcandReg.Stop()
+			log.Infof("Got signal %v, canceling registration", sig)
+			app.registrar.Stop()
 		}()
 	}
+	return app.RunContext(ctx)
+}
+
+// RunContext starts the app on the configured host/port just like Run, but instead of handling signals
+// it shuts down gracefully when the context is done or Stop is called.
+//
+// The start hooks are called before the app is registered in vulcand and starts serving requests, and
+// the shutdown hooks after the HTTP server has stopped, see OnStart and OnShutdown. Errors of the hooks
+// and of the shutdown are returned together as `MultiError`. Like http.Server.ListenAndServe, returns
+// http.ErrServerClosed if the app has been shut down without errors.
+func (app *App) RunContext(ctx context.Context) error {
+	app.done = make(chan struct{})
+	app.once = &sync.Once{}
+
+	if err := app.runStartHooks(ctx); err != nil {
+		return joinErrors(append([]error{err}, app.runShutdownHooks()...))
+	}
+
+	if app.registrar != nil {
+		err := app.registrar.Start()
+		if err != nil {
+			err = fmt.Errorf("failed to start registrar: err=(%s)", err)
+			return joinErrors(append([]error{err}, app.runShutdownHooks()...))
+		}
+	}
 
 	addr := fmt.Sprintf("%v:%v", app.Config.ListenIP, app.Config.ListenPort)
 	httpSrv := &http.Server{
@@ -183,43 +363,80 @@ func (app *App) Run() error {
 		ReadTimeout:  app.Config.HTTP.ReadTimeout,
 		WriteTimeout: app.Config.HTTP.WriteTimeout,
 		IdleTimeout:  app.Config.HTTP.IdleTimeout,
-		Handler:      app.router,
+		Handler:      app.GetHandler(),
 	}
 
-	// listen for a shutdown signal
-	app.done = make(chan struct{})
-	app.once = &sync.Once{}
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
-
-	// Start a stop signal waiting goroutine.
+	// Start a stop waiting goroutine.
+	var drainErr error
 	app.wg.Add(1)
 	go func() {
 		defer app.wg.Done()
 		select {
-		case s := <-signalCh:
-			log.Infof("Got signal %v, shutting down", s)
+		case <-ctx.Done():
 		case <-app.done:
 		}
-		if app.vulcandReg != nil {
-			app.vulcandReg.Stop()
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
-		if err := httpSrv.Shutdown(ctx); err != nil {
-			log.Errorf("Failed to shutdown HTTP server: err=%v", err)
-		}
+		drainErr = app.drain(httpSrv)
 	}()
 	err := httpSrv.ListenAndServe()
 
-	// In case the HTTP server failed to start we need to stop the signal
+	// In case the HTTP server failed to start we need to stop the
 	// waiting goroutine. But it would not hurt to close the channel, even if
-	// the HTTP server was terminated from the signal waiting goroutine.
+	// the HTTP server was terminated from the waiting goroutine.
 	app.Stop()
 
 	// Wait for the HTTP server to stop gracefully.
 	app.wg.Wait()
-	return err
+
+	var errs []error
+	if err != http.ErrServerClosed {
+		errs = append(errs, err)
+	}
+	errs = append(errs, drainErr)
+	errs = append(errs, app.runShutdownHooks()...)
+	if err := joinErrors(errs); err != nil {
+		return err
+	}
+	return http.ErrServerClosed
+}
+
+// drain stops the HTTP server gracefully: readiness fails first, then the app deregisters from vulcand
+// and waits for the change to propagate, so that no new requests are routed to it by the time the server
+// stops accepting connections.
+func (app *App) drain(httpSrv *http.Server) error {
+	app.setShuttingDown()
+	log.Infof("Draining, in-flight requests=%d", app.InFlightRequests())
+
+	if app.registrar != nil {
+		app.registrar.Stop()
+	}
+	if delay := app.Config.Shutdown.DrainDelay; delay > 0 {
+		log.Infof("Waiting %v for deregistration to propagate", delay)
+		time.Sleep(delay)
+	}
+
+	log.Infof("Shutting down HTTP server, in-flight requests=%d", app.InFlightRequests())
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.Shutdown.Timeout)
+	defer cancel()
+	if err := httpSrv.Shutdown(ctx); err != nil {
+		log.Errorf("Failed to shutdown HTTP server: err=%v, in-flight requests=%d", err, app.InFlightRequests())
+		return err
+	}
+	log.Infof("HTTP server stopped")
+	return nil
+}
+
+// InFlightRequests returns the number of requests being served by the app's handlers.
+func (app *App) InFlightRequests() int64 {
+	return atomic.LoadInt64(&app.inFlight)
+}
+
+// countInFlight wraps the handler so that the requests it serves are counted while in flight.
+func (app *App) countInFlight(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&app.inFlight, 1)
+		defer atomic.AddInt64(&app.inFlight, -1)
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func (app *App) Stop() {
@@ -235,8 +452,16 @@ func (app *App) registerFrontend(methods []string, path string, scope Scope, mid
 	if err != nil {
 		return err
 	}
-	app.vulcandReg.AddFrontend(host, path, methods, middlewares)
-	return nil
+	return app.registrar.AddFrontend(host, path, methods, middlewares)
+}
+
+// deregisterFrontend withdraws the frontend registered with registerFrontend.
+func (app *App) deregisterFrontend(methods []string, path string, scope Scope) error {
+	host, err := app.apiHostForScope(scope)
+	if err != nil {
+		return err
+	}
+	return app.registrar.RemoveFrontend(host, path, methods)
 }
 
 // apiHostForScope is a helper that returns an appropriate API hostname for a provided scope.
@@ -0,0 +1,80 @@
+package scroll
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type AppSuite struct{}
+
+var _ = Suite(&AppSuite{})
+
+func (s *AppSuite) TestDrain(c *C) {
+	config := AppConfig{Name: "test"}
+	config.Shutdown.DrainDelay = 50 * time.Millisecond
+	app, srv, started, release := s.newBlockingApp(c, config)
+	defer srv.Close()
+
+	replied := make(chan int)
+	go func() {
+		resp, err := http.Get(srv.URL + "/slow")
+		c.Check(err, IsNil)
+		resp.Body.Close()
+		replied <- resp.StatusCode
+	}()
+	<-started
+	c.Assert(app.InFlightRequests(), Equals, int64(1))
+
+	drained := make(chan error)
+	go func() { drained <- app.drain(srv.Config) }()
+	for !app.isShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The server keeps serving during the drain delay, but is not ready anymore.
+	resp, err := http.Get(srv.URL + "/_health/ready")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusServiceUnavailable)
+
+	close(release)
+	c.Assert(<-replied, Equals, http.StatusOK)
+	c.Assert(<-drained, IsNil)
+	c.Assert(app.InFlightRequests(), Equals, int64(0))
+}
+
+func (s *AppSuite) TestDrainTimeout(c *C) {
+	config := AppConfig{Name: "test"}
+	config.Shutdown.Timeout = 10 * time.Millisecond
+	app, srv, started, release := s.newBlockingApp(c, config)
+	defer srv.Close()
+	defer close(release)
+
+	go http.Get(srv.URL + "/slow")
+	<-started
+
+	c.Assert(app.drain(srv.Config), Equals, context.DeadlineExceeded)
+	c.Assert(app.InFlightRequests(), Equals, int64(1))
+}
+
+// newBlockingApp runs an app with a handler at /slow that blocks until release is closed.
+func (s *AppSuite) newBlockingApp(c *C, config AppConfig) (*App, *httptest.Server, chan struct{}, chan struct{}) {
+	app, err := NewAppWithConfig(config)
+	c.Assert(err, IsNil)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/slow"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return Response{}, nil
+		},
+	}), IsNil)
+	return app, httptest.NewServer(app.GetHandler()), started, release
+}
@@ -0,0 +1,259 @@
+package scroll
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/log"
+)
+
+// Name of the form field holding the batch items unless Spec.BatchField is provided.
+const defaultBatchField = "items"
+
+// Defines the signature of a function that processes a single item of a batch request.
+//
+// The 2nd parameter is a map of variables extracted from the request path, just like for HandlerFunc,
+// and the 3rd one is the item decoded into a new instance of the Spec.BatchItem type. It is always
+// a pointer, e.g. if the spec was:
+//  Spec{BatchItem: Event{}, BatchHandler: storeEvent}
+// then the function can get the decoded item with:
+//  event := item.(*Event)
+//
+// The function is called concurrently for different items of a batch, so it does not get the response
+// writer. It should return a JSON marshallable result of the item, or an error which is converted into
+// the item status and error response just like errors returned by handlers.
+type BatchHandlerFunc func(*http.Request, map[string]string, interface{}) (interface{}, error)
+
+// BatchResult is the outcome of processing a single item of a batch request.
+type BatchResult struct {
+	// Position of the item in the batch, starting with 0.
+	Index int `json:"index"`
+
+	// HTTP status code the item would be replied with if it was sent alone.
+	Status int `json:"status"`
+
+	// Result returned for the item by the batch function, if it succeeded.
+	Result interface{} `json:"result,omitempty"`
+
+	// Error response of the item, if it failed.
+	Error interface{} `json:"error,omitempty"`
+}
+
+// Make a handler out of BatchHandlerFunc, just like regular MakeHandler function.
+//
+// The request body is decoded into a list of items: a JSON array, or repeated form fields named
+// Spec.BatchField. Struct items are sent as JSON objects in forms too. Batches of more than MaxBatchSize
+// items are rejected with `BatchTooLargeError` as a whole. Otherwise, every item is decoded and
+// validated just like the JSONHandler requests and passed to the batch function, with up to
+// Spec.BatchConcurrency items processed at the same time.
+//
+// The reply is 200 with the result of every item in the order of the batch, unless the batch itself
+// is malformed, e.g.:
+//
+//  {"items": [{"index": 0, "status": 200, "result": {...}}, {"index": 1, "status": 400, "error": {...}}], "failed": 1}
+//
+// A spec without a valid Spec.BatchItem is logged and makes a handler that fails every request with
+// 500, as the items can not be decoded. AddHandler rejects such specs instead.
+func MakeBatchHandler(app *App, fn BatchHandlerFunc, spec Spec) http.HandlerFunc {
+	if err := checkBatchItem(spec); err != nil {
+		log.Errorf("invalid batch handler spec: %v", err)
+		return func(w http.ResponseWriter, r *http.Request) {
+			r = withRequestID(w, r)
+			serveRequest(app, spec, w, r, func() (interface{}, int, error) {
+				return app.handlerResult(w, nil, err)
+			})
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		serveRequest(app, spec, w, r, func() (interface{}, int, error) {
+			body, err := readBody(r, spec.MaxBodySize)
+			if err != nil {
+				if _, ok := err.(InvalidParameterError); ok {
+					return app.handlerResult(w, nil, err)
+				}
+				return bodyError(err)
+			}
+			// Let the form parser read the body again in case it is a form.
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err := parseForm(r); err != nil {
+				return formError(err)
+			}
+			items, err := decodeBatch(r, body, spec)
+			if err != nil {
+				return app.handlerResult(w, nil, err)
+			}
+
+			results := app.runBatch(r, fn, spec, items)
+			failed := 0
+			for _, result := range results {
+				if result.Error != nil {
+					failed++
+				}
+			}
+			app.stats.TrackBatch(requestStats(spec, r), len(items), failed)
+			return Response{"items": results, "failed": failed}, http.StatusOK, nil
+		})
+	}
+}
+
+// checkBatchItem returns an error if the spec does not provide a batch item type the items can be
+// decoded into.
+func checkBatchItem(spec Spec) error {
+	if spec.BatchItem == nil {
+		return fmt.Errorf("the spec does not provide a batch item type: %v", spec)
+	}
+	return checkValidateTags(reflect.TypeOf(spec.BatchItem))
+}
+
+// batchItem is a decoded item of a batch, or the error that prevented decoding it.
+type batchItem struct {
+	value interface{}
+	err   error
+}
+
+// decodeBatch splits the request body into items and decodes each one of them into a new instance
+// of the Spec.BatchItem type. Items that fail to decode or validate do not fail the whole batch.
+func decodeBatch(r *http.Request, body []byte, spec Spec) ([]batchItem, error) {
+	field := spec.BatchField
+	if field == "" {
+		field = defaultBatchField
+	}
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, InvalidFormatError{"Content-Type", contentType}
+		}
+	}
+
+	// The decoders return what the item was decoded from, for validate to tell the provided fields.
+	var decoders []func(v interface{}) (interface{}, error)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if len(body) == 0 {
+			return nil, MissingFieldError{field}
+		}
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, jsonError(err)
+		}
+		for _, data := range raw {
+			data := data
+			decoders = append(decoders, func(v interface{}) (interface{}, error) {
+				return unmarshalJSON(data, v)
+			})
+		}
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		// The order of the items matters, so the PHP style indexed fields are not supported.
+		values := append(r.Form[field], r.Form[field+"[]"]...)
+		if len(values) == 0 {
+			return nil, MissingFieldError{field}
+		}
+		for _, value := range values {
+			value := value
+			decoders = append(decoders, func(v interface{}) (interface{}, error) {
+				elem := reflect.ValueOf(v).Elem()
+				if elem.Kind() == reflect.Struct {
+					return unmarshalJSON([]byte(value), v)
+				}
+				if err := setFromString(elem, value); err != nil {
+					return nil, InvalidFormatError{field, value}
+				}
+				return value, nil
+			})
+		}
+	default:
+		return nil, InvalidParameterError{"Content-Type", mediaType}
+	}
+
+	if len(decoders) > MaxBatchSize {
+		return nil, BatchTooLargeError{len(decoders), MaxBatchSize}
+	}
+
+	t := reflect.TypeOf(spec.BatchItem)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	items := make([]batchItem, len(decoders))
+	for i, decode := range decoders {
+		item := reflect.New(t)
+		provided, err := decode(item.Interface())
+		if err != nil {
+			items[i].err = err
+			continue
+		}
+		if err := validate(item, provided); err != nil {
+			items[i].err = err
+			continue
+		}
+		items[i].value = item.Interface()
+	}
+	return items, nil
+}
+
+// runBatch calls the batch function for every successfully decoded item with bounded concurrency
+// and collects the results in the order of the items.
+func (app *App) runBatch(r *http.Request, fn BatchHandlerFunc, spec Spec, items []batchItem) []BatchResult {
+	concurrency := spec.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	params := DecodeParams(mux.Vars(r))
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := items[i].err
+				var result interface{}
+				if err == nil {
+					result, err = app.callBatchFunc(r, spec, fn, params, items[i].value)
+				}
+				results[i] = app.batchResult(i, result, err)
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// callBatchFunc calls the batch function for the item. Items run in their own goroutines, so a panic
+// is recovered here and fails just the item.
+func (app *App) callBatchFunc(r *http.Request, spec Spec, fn BatchHandlerFunc, params map[string]string, item interface{}) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			result, err = nil, app.handlePanic(r, spec, p)
+		}
+	}()
+	return fn(r, params, item)
+}
+
+// batchResult converts the values returned by a batch function into the result of the item.
+func (app *App) batchResult(index int, result interface{}, err error) BatchResult {
+	if err != nil {
+		response, status, _ := app.errorBody(err)
+		return BatchResult{Index: index, Status: status, Error: response}
+	}
+	return BatchResult{Index: index, Status: http.StatusOK, Result: result}
+}
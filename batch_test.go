@@ -0,0 +1,175 @@
+package scroll
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type BatchSuite struct {
+	app *App
+}
+
+var _ = Suite(&BatchSuite{})
+
+func (s *BatchSuite) SetUpTest(c *C) {
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+}
+
+type batchEvent struct {
+	ID   string `json:"id" validate:"required"`
+	Size int    `json:"size"`
+}
+
+func (s *BatchSuite) serve(c *C, spec Spec, contentType, body string) map[string]interface{} {
+	r := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	MakeBatchHandler(s.app, spec.BatchHandler, spec)(w, r)
+
+	var response map[string]interface{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &response), IsNil)
+	response["status"] = w.Code
+	return response
+}
+
+func (s *BatchSuite) TestJSONBatch(c *C) {
+	spec := Spec{
+		BatchItem: batchEvent{},
+		BatchHandler: func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+			event := item.(*batchEvent)
+			if event.Size > 10 {
+				return nil, ConflictError{"too big"}
+			}
+			return Response{"id": event.ID}, nil
+		},
+	}
+	response := s.serve(c, spec, "application/json", `[{"id": "a"}, {"size": 1}, {"id": "c", "size": 20}, {"id": 1}]`)
+
+	c.Assert(response["status"], Equals, http.StatusOK)
+	c.Assert(response["failed"], Equals, 3.0)
+	items := response["items"].([]interface{})
+	c.Assert(items, HasLen, 4)
+	c.Assert(items[0], DeepEquals, map[string]interface{}{
+		"index": 0.0, "status": 200.0, "result": map[string]interface{}{"id": "a"}})
+	c.Assert(items[1], DeepEquals, map[string]interface{}{
+		"index": 1.0, "status": 400.0, "error": map[string]interface{}{"message": "Missing mandatory parameter: id"}})
+	c.Assert(items[2], DeepEquals, map[string]interface{}{
+		"index": 2.0, "status": 409.0, "error": map[string]interface{}{"message": "too big"}})
+	c.Assert(items[3], DeepEquals, map[string]interface{}{
+		"index": 3.0, "status": 400.0, "error": map[string]interface{}{"message": "Invalid format for parameter id: number"}})
+}
+
+func (s *BatchSuite) TestFormBatch(c *C) {
+	spec := Spec{
+		BatchItem:  0,
+		BatchField: "size",
+		BatchHandler: func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+			return *item.(*int) * 2, nil
+		},
+	}
+	response := s.serve(c, spec, "application/x-www-form-urlencoded", "size=1&size=x&size=3")
+
+	c.Assert(response["failed"], Equals, 1.0)
+	items := response["items"].([]interface{})
+	c.Assert(items[0].(map[string]interface{})["result"], Equals, 2.0)
+	c.Assert(items[1].(map[string]interface{})["status"], Equals, 400.0)
+	c.Assert(items[2].(map[string]interface{})["result"], Equals, 6.0)
+}
+
+func (s *BatchSuite) TestInvalidBatch(c *C) {
+	spec := Spec{
+		BatchItem: batchEvent{},
+		BatchHandler: func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+			c.Fatal("must not be called")
+			return nil, nil
+		},
+	}
+	tooLarge := "[" + strings.Repeat(`{"id": "a"},`, MaxBatchSize) + `{"id": "a"}]`
+	for i, tc := range []struct {
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{{
+		contentType: "application/json",
+		body:        tooLarge,
+		status:      http.StatusRequestEntityTooLarge,
+		message:     fmt.Sprintf("Batch of %d items exceeds the limit of %d items", MaxBatchSize+1, MaxBatchSize),
+	}, {
+		contentType: "application/json",
+		body:        `{"id": "a"}`,
+		status:      http.StatusBadRequest,
+		message:     "Invalid format for parameter body: object",
+	}, {
+		contentType: "application/json",
+		body:        "",
+		status:      http.StatusBadRequest,
+		message:     "Missing mandatory parameter: items",
+	}, {
+		contentType: "application/x-www-form-urlencoded",
+		body:        "id=a",
+		status:      http.StatusBadRequest,
+		message:     "Missing mandatory parameter: items",
+	}} {
+		c.Logf("Test case #%d", i)
+		response := s.serve(c, spec, tc.contentType, tc.body)
+		c.Assert(response["status"], Equals, tc.status)
+		c.Assert(response["message"], Equals, tc.message)
+	}
+}
+
+// Handlers made directly for a spec without a batch item type fail instead of panicking.
+func (s *BatchSuite) TestNoBatchItem(c *C) {
+	spec := Spec{
+		BatchHandler: func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+			c.Fatal("must not be called")
+			return nil, nil
+		},
+	}
+	response := s.serve(c, spec, "application/json", `[{"id": "a"}]`)
+	c.Assert(response["status"], Equals, http.StatusInternalServerError)
+	c.Assert(response["message"], Equals, "Internal Server Error")
+
+	spec.Paths = []string{"/events"}
+	c.Assert(s.app.AddHandler(spec), ErrorMatches, "the spec does not provide a batch item type: .*")
+}
+
+func (s *BatchSuite) TestConcurrency(c *C) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	spec := Spec{
+		BatchItem:        batchEvent{},
+		BatchConcurrency: 3,
+		BatchHandler: func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return item.(*batchEvent).ID, nil
+		},
+	}
+	body := "[" + strings.Repeat(`{"id": "a"},`, 9) + `{"id": "b"}]`
+	response := s.serve(c, spec, "application/json", body)
+
+	c.Assert(response["failed"], Equals, 0.0)
+	items := response["items"].([]interface{})
+	c.Assert(items, HasLen, 10)
+	c.Assert(items[9].(map[string]interface{})["result"], Equals, "b")
+	c.Assert(maxRunning > 1, Equals, true)
+	c.Assert(maxRunning <= 3, Equals, true)
+}
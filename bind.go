@@ -0,0 +1,182 @@
+package scroll
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Bind populates the fields of the struct pointed to by dst from the request form fields and path
+// variables, as instructed by the field tags, e.g.:
+//
+//  type listEvents struct {
+//      Domain string        `var:"domain" allow:"example.com,example.org"`
+//      Limit  int           `form:"limit" default:"100" min:"1" max:"300"`
+//      Sort   string        `form:"sort" default:"desc" allow:"asc,desc"`
+//      Begin  time.Time     `form:"begin" required:"true"`
+//      TTL    time.Duration `form:"ttl"`
+//      Tags   []string      `form:"tags"`
+//  }
+//
+// `form` and `var` name the form field or path variable a struct field is populated from. Fields
+// without either tag are left intact. The other tags are optional:
+//
+//  - `default` is the value used if the form field is missing, a comma separated list for slices;
+//  - `required:"true"` makes a missing field without a default fail with `MissingFieldError`;
+//  - `allow` is a comma separated list of allowed values, other values fail with `UnsafeFieldError`;
+//  - `min` and `max` limit numbers or the length of strings and slices, failing with `InvalidParameterError`.
+//
+// Strings, booleans, integers, floats, time.Duration, time.Time (RFC1123 format), pointers to them
+// and slices of them are supported. Slices are populated from fields with the same name, including
+// the PHP ("tags[0]", "tags[1]") and Ruby ("tags[]") array conventions. Values that can not be
+// parsed fail with `InvalidFormatError`.
+//
+// All failed fields are reported at once with `ValidationErrors`.
+func Bind(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a pointer to a struct, got %T", dst)
+	}
+	if r.Form == nil {
+		if err := parseForm(r); err != nil {
+			return fmt.Errorf("Failed to parse request form: %v", err)
+		}
+	}
+
+	var errs ValidationErrors
+	if err := bindStruct(r, DecodeParams(mux.Vars(r)), v.Elem(), &errs); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindStruct binds the struct fields, collecting the errors of failed fields. Returns an error if
+// the struct can not be bound at all, e.g. due to an unsupported field type.
+func bindStruct(r *http.Request, vars map[string]string, v reflect.Value, errs *ValidationErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		formName, varName := sf.Tag.Get("form"), sf.Tag.Get("var")
+
+		// Fields of embedded structs are promoted, even if the struct type itself is not exported.
+		if sf.Anonymous && formName == "" && varName == "" && fv.Kind() == reflect.Struct {
+			if err := bindStruct(r, vars, fv, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" || (formName == "" && varName == "") {
+			continue
+		}
+		if err := bindField(r, vars, sf, fv, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindField binds a single struct field.
+func bindField(r *http.Request, vars map[string]string, sf reflect.StructField, v reflect.Value, errs *ValidationErrors) error {
+	isSlice := v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+	elemType := v.Type()
+	if isSlice {
+		elemType = elemType.Elem()
+	}
+	if !bindable(elemType) {
+		return fmt.Errorf("unsupported type %v of field %v", v.Type(), sf.Name)
+	}
+
+	var name string
+	var values []string
+	if name = sf.Tag.Get("var"); name != "" {
+		if value, ok := vars[name]; ok {
+			values = []string{value}
+		}
+	} else {
+		name = sf.Tag.Get("form")
+		if isSlice {
+			values, _ = GetMultipleFields(r, name)
+		} else if HasField(r, name) {
+			values = []string{r.FormValue(name)}
+		}
+	}
+
+	if len(values) == 0 {
+		def, ok := sf.Tag.Lookup("default")
+		if !ok {
+			if sf.Tag.Get("required") == "true" {
+				*errs = append(*errs, MissingFieldError{name})
+			}
+			return nil
+		}
+		values = []string{def}
+		if isSlice {
+			values = strings.Split(def, ",")
+		}
+	}
+
+	if allow := sf.Tag.Get("allow"); allow != "" {
+		allowSet := NewAllowSetStrings(strings.Split(allow, ","))
+		for _, value := range values {
+			if err := allowSet.IsSafe(value); err != nil {
+				*errs = append(*errs, UnsafeFieldError{name, err.Error()})
+				return nil
+			}
+		}
+	}
+
+	target := reflect.New(v.Type()).Elem()
+	if isSlice {
+		target.Set(reflect.MakeSlice(v.Type(), len(values), len(values)))
+		for i, value := range values {
+			if err := setFromString(target.Index(i), value); err != nil {
+				*errs = append(*errs, InvalidFormatError{name, value})
+				return nil
+			}
+		}
+	} else if err := setFromString(target, values[0]); err != nil {
+		*errs = append(*errs, InvalidFormatError{name, values[0]})
+		return nil
+	}
+
+	for _, rule := range []string{"min", "max"} {
+		limit, ok := sf.Tag.Lookup(rule)
+		if !ok {
+			continue
+		}
+		if err := validateRule(target, name, rule+"="+limit, true); err != nil {
+			if _, ok := err.(InvalidParameterError); !ok {
+				return err
+			}
+			*errs = append(*errs, err)
+			return nil
+		}
+	}
+	v.Set(target)
+	return nil
+}
+
+// bindable tells whether values of the type can be parsed from strings.
+func bindable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType || t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
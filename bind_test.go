@@ -0,0 +1,115 @@
+package scroll
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+type BindSuite struct{}
+
+var _ = Suite(&BindSuite{})
+
+type pagingParams struct {
+	Limit int `form:"limit" default:"100" max:"300"`
+}
+
+type listParams struct {
+	pagingParams
+	Domain string        `var:"domain"`
+	Sort   string        `form:"sort" default:"desc" allow:"asc,desc"`
+	Begin  time.Time     `form:"begin"`
+	TTL    time.Duration `form:"ttl"`
+	Ratio  *float64      `form:"ratio"`
+	Strict bool          `form:"strict"`
+	Tags   []string      `form:"tags"`
+	IDs    []int         `form:"ids" default:"1,2"`
+	Name   string        `form:"name" required:"true"`
+	Note   string
+}
+
+func newBindRequest(form url.Values, vars map[string]string) *http.Request {
+	request, _ := http.NewRequest("GET", "http://example.com", nil)
+	request.Form = form
+	return mux.SetURLVars(request, vars)
+}
+
+func (s *BindSuite) TestBind(c *C) {
+	request := newBindRequest(url.Values{
+		"name":    {"foo"},
+		"limit":   {"20"},
+		"sort":    {"asc"},
+		"begin":   {"Mon, 02 Jan 2006 15:04:05 MST"},
+		"ttl":     {"1h"},
+		"ratio":   {"0.5"},
+		"strict":  {"true"},
+		"tags[0]": {"a"},
+		"ids[]":   {"3", "4"},
+	}, map[string]string{"domain": "example%2Ecom"})
+
+	params := listParams{Note: "intact"}
+	c.Assert(Bind(request, &params), IsNil)
+
+	ratio := 0.5
+	c.Assert(params, DeepEquals, listParams{
+		pagingParams: pagingParams{Limit: 20},
+		Domain:       "example.com",
+		Sort:         "asc",
+		Begin:        params.Begin,
+		TTL:          time.Hour,
+		Ratio:        &ratio,
+		Strict:       true,
+		Tags:         []string{"a"},
+		IDs:          []int{3, 4},
+		Name:         "foo",
+		Note:         "intact",
+	})
+	c.Assert(params.Begin.Unix(), Equals, int64(1136214245))
+}
+
+func (s *BindSuite) TestDefaults(c *C) {
+	request := newBindRequest(url.Values{"name": {"foo"}}, nil)
+
+	var params listParams
+	c.Assert(Bind(request, &params), IsNil)
+	c.Assert(params.Limit, Equals, 100)
+	c.Assert(params.Sort, Equals, "desc")
+	c.Assert(params.IDs, DeepEquals, []int{1, 2})
+	c.Assert(params.Ratio, IsNil)
+	c.Assert(params.Tags, IsNil)
+}
+
+func (s *BindSuite) TestErrors(c *C) {
+	request := newBindRequest(url.Values{
+		"limit": {"1000"},
+		"sort":  {"random"},
+		"ttl":   {"-1h"},
+		"ids":   {"1", "two"},
+	}, nil)
+
+	var params listParams
+	err := Bind(request, &params)
+	c.Assert(err, DeepEquals, ValidationErrors{
+		InvalidParameterError{"limit", "must be at most 300"},
+		UnsafeFieldError{"sort", "string random not allowed"},
+		InvalidFormatError{"ttl", "-1h"},
+		InvalidFormatError{"ids", "two"},
+		MissingFieldError{"name"},
+	})
+	c.Assert(params.Limit, Equals, 0)
+}
+
+func (s *BindSuite) TestInvalidDestination(c *C) {
+	request := newBindRequest(url.Values{}, nil)
+
+	var params listParams
+	c.Assert(Bind(request, params), ErrorMatches, "bind destination must be a pointer to a struct.*")
+
+	var unsupported struct {
+		Values map[string]string `form:"values"`
+	}
+	c.Assert(Bind(request, &unsupported), ErrorMatches, "unsupported type map\\[string\\]string of field Values")
+}
@@ -25,10 +25,20 @@ const (
 	// Suggested max allowed amount of entries that batch APIs can accept (e.g. batch uploads).
 	MaxBatchSize = 1000
 
+	// Number of batch items processed concurrently unless Spec.BatchConcurrency is provided.
+	DefaultBatchConcurrency = 10
+
+	// Max size of a request body accepted by JSON handlers unless Spec.MaxBodySize is provided.
+	DefaultMaxBodySize = 10 << 20
+
+	// Time a health check is given to complete unless another timeout is provided.
+	DefaultHealthCheckTimeout = 5 * time.Second
+
 	defaultHTTPReadTimeout  = 10 * time.Second
 	defaultHTTPWriteTimeout = 60 * time.Second
 	defaultHTTPIdleTimeout  = 60 * time.Second
 	defaultRegistrationTTL  = 30 * time.Second
+	defaultShutdownTimeout  = 60 * time.Second
 	defaultNamespace        = "/vulcand"
 )
 
@@ -44,6 +54,7 @@ func applyDefaults(cfg *AppConfig) error {
 	holster.SetDefault(&cfg.HTTP.ReadTimeout, defaultHTTPReadTimeout)
 	holster.SetDefault(&cfg.HTTP.WriteTimeout, defaultHTTPWriteTimeout)
 	holster.SetDefault(&cfg.HTTP.IdleTimeout, defaultHTTPIdleTimeout)
+	holster.SetDefault(&cfg.Shutdown.Timeout, defaultShutdownTimeout)
 
 	holster.SetDefault(&cfg.Vulcand.TTL, defaultRegistrationTTL)
 	holster.SetDefault(&cfg.Vulcand.Etcd, &etcd.Config{})
@@ -91,6 +102,9 @@ func fetchEtcdConfig(cfg *AppConfig) error {
 	cfg.PublicAPIURL = jsonCfg.PublicAPIURL
 	cfg.ProtectedAPIHost = jsonCfg.ProtectedAPIHost
 	cfg.ProtectedAPIURL = jsonCfg.ProtectedAPIURL
+	if len(cfg.CursorKey) == 0 && jsonCfg.CursorKey != "" {
+		cfg.CursorKey = []byte(jsonCfg.CursorKey)
+	}
 
 	return nil
 }
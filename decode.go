@@ -0,0 +1,484 @@
+package scroll
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Validator can be implemented by JSONHandler request types that need checks which can not be
+// expressed with `validate` struct tags. It is called after the tag based validation succeeds.
+type Validator interface {
+	Validate() error
+}
+
+// readBody reads the request body making sure it is not larger than maxSize bytes. If the body is
+// too large, returns `InvalidParameterError`.
+func readBody(r *http.Request, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, InvalidParameterError{"body", fmt.Sprintf("is larger than %d bytes", maxSize)}
+	}
+	return body, nil
+}
+
+// decodeBody decodes the request body into a new instance of the reqType type according to
+// the request Content-Type and validates it. Returns a pointer to the decoded value.
+func decodeBody(r *http.Request, body []byte, reqType interface{}) (interface{}, error) {
+	t := reflect.TypeOf(reqType)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	req := reflect.New(t)
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, InvalidFormatError{"Content-Type", contentType}
+		}
+	}
+
+	var provided interface{}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if len(body) != 0 {
+			var err error
+			if provided, err = unmarshalJSON(body, req.Interface()); err != nil {
+				return nil, err
+			}
+		}
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		if err := decodeForm(r.Form, req.Elem()); err != nil {
+			return nil, err
+		}
+		fields := make(map[string]interface{}, len(r.Form))
+		for name, values := range r.Form {
+			fields[name] = values
+		}
+		provided = fields
+	default:
+		return nil, InvalidParameterError{"Content-Type", mediaType}
+	}
+
+	if err := validate(req, provided); err != nil {
+		return nil, err
+	}
+	return req.Interface(), nil
+}
+
+// unmarshalJSON decodes the JSON data into v. It returns the data decoded into generic values too, for
+// validate to tell the fields that were provided from the ones that were not.
+func unmarshalJSON(data []byte, v interface{}) (interface{}, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, jsonError(err)
+	}
+	var provided interface{}
+	if err := json.Unmarshal(data, &provided); err != nil {
+		return nil, jsonError(err)
+	}
+	return provided, nil
+}
+
+// validate checks the decoded value pointed to by v against its `validate` struct tags, if it is
+// a struct, and then with its Validate method, if it implements Validator. The provided value is
+// what the value was decoded from, as generic values: objects are maps of the provided fields.
+func validate(v reflect.Value, provided interface{}) error {
+	if v.Elem().Kind() == reflect.Struct {
+		if err := validateStruct(v.Elem(), "", provided); err != nil {
+			return err
+		}
+	}
+	if validator, ok := v.Interface().(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// jsonError converts a JSON decoding error into one of the API errors.
+func jsonError(err error) error {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		field := e.Field
+		if field == "" {
+			field = "body"
+		}
+		return InvalidFormatError{field, e.Value}
+	case *json.SyntaxError:
+		return InvalidFormatError{"body", e.Error()}
+	default:
+		return InvalidFormatError{"body", err.Error()}
+	}
+}
+
+// decodeForm populates the fields of the provided struct from the form values, matching them by
+// their JSON names. Only fields of basic types and slices of them are supported.
+func decodeForm(form url.Values, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := fieldName(sf)
+		if !ok {
+			continue
+		}
+		values, ok := form[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			s := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for j, value := range values {
+				if err := setFromString(s.Index(j), value); err != nil {
+					return InvalidFormatError{name, value}
+				}
+			}
+			fv.Set(s)
+			continue
+		}
+		if err := setFromString(fv, values[0]); err != nil {
+			return InvalidFormatError{name, values[0]}
+		}
+	}
+	return nil
+}
+
+// setFromString parses the string into the value according to its kind. Durations must not be negative
+// and timestamps must be in one of the formats accepted by GetTimestampField.
+func setFromString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setFromString(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		if d < 0 {
+			return fmt.Errorf("negative duration: %v", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := parseTimestamp(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type: %v", v.Type())
+	}
+	return nil
+}
+
+// fieldName returns the JSON name of a struct field. Returns false if the field is not exported
+// or explicitly excluded from JSON.
+func fieldName(sf reflect.StructField) (string, bool) {
+	if sf.PkgPath != "" {
+		return "", false
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return sf.Name, true
+}
+
+// validateStruct checks the struct fields against the rules in their `validate` tags, e.g.:
+//
+//  Limit int      `json:"limit" validate:"required,min=1,max=100"`
+//  Sort  string   `json:"sort" validate:"oneof=asc desc"`
+//  Tags  []string `json:"tags" validate:"max=10"`
+//
+// `required` fails with `MissingFieldError` if a field is not provided or is null, so that zero values,
+// e.g. 0 or false, can be required too. `min` and `max` limit numbers or the length of strings, slices
+// and maps, while `oneof` lists the allowed values; they fail with `InvalidParameterError` and are not
+// checked for fields that are not provided. Nested structs are validated recursively.
+func validateStruct(v reflect.Value, prefix string, provided interface{}) error {
+	fields, _ := provided.(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := fieldName(sf)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+
+		// Fields of embedded structs are promoted, just like encoding/json does.
+		if sf.Anonymous && sf.Tag.Get("json") == "" && fv.Kind() == reflect.Struct {
+			if err := validateStruct(fv, prefix, provided); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, present := providedField(fields, name)
+		name = prefix + name
+
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				if err := validateRule(fv, name, rule, present); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := validateNested(fv, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// providedField returns the value of the field with the JSON name from the provided fields. Like
+// encoding/json, it falls back to a case-insensitive match. Fields that are null are not provided.
+func providedField(fields map[string]interface{}, name string) (interface{}, bool) {
+	value, ok := fields[name]
+	if !ok {
+		for key, v := range fields {
+			if strings.EqualFold(key, name) {
+				value, ok = v, true
+				break
+			}
+		}
+	}
+	return value, ok && value != nil
+}
+
+// validateNested validates structs contained in the field value.
+func validateNested(v reflect.Value, name string, provided interface{}) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return validateNested(v.Elem(), name, provided)
+		}
+	case reflect.Struct:
+		return validateStruct(v, name+".", provided)
+	case reflect.Slice, reflect.Array:
+		if k := v.Type().Elem().Kind(); k != reflect.Struct && k != reflect.Ptr {
+			return nil
+		}
+		items, _ := provided.([]interface{})
+		for i := 0; i < v.Len(); i++ {
+			var item interface{}
+			if i < len(items) {
+				item = items[i]
+			}
+			if err := validateNested(v.Index(i), fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateRule checks the value against a single validation rule. The present flag tells whether
+// the value was provided.
+func validateRule(v reflect.Value, name, rule string, present bool) error {
+	if err := checkRule(v.Type(), name, rule); err != nil {
+		return err
+	}
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return nil
+	}
+	if rule == "required" {
+		if !present {
+			return MissingFieldError{name}
+		}
+		return nil
+	}
+
+	// The rest of the rules do not apply to values that were not provided.
+	if !present {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	parts := strings.SplitN(rule, "=", 2)
+	switch parts[0] {
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(parts[1], 64)
+		value, isLength := measure(v)
+		what := "must be"
+		if isLength {
+			what = "length must be"
+		}
+		if parts[0] == "min" && value < limit {
+			return InvalidParameterError{name, fmt.Sprintf("%s at least %v", what, parts[1])}
+		}
+		if parts[0] == "max" && value > limit {
+			return InvalidParameterError{name, fmt.Sprintf("%s at most %v", what, parts[1])}
+		}
+	case "oneof":
+		allowed := strings.Fields(parts[1])
+		value := fmt.Sprint(v.Interface())
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return InvalidParameterError{name, fmt.Sprintf("must be one of %v", allowed)}
+	}
+	return nil
+}
+
+// checkValidateTags returns an error if a `validate` tag of the struct type, or of the structs it
+// contains, has a malformed rule, so that handlers with such tags are rejected when they are added
+// rather than failing the requests they serve.
+func checkValidateTags(t reflect.Type) error {
+	return checkStructTags(t, "", make(map[reflect.Type]bool))
+}
+
+func checkStructTags(t reflect.Type, prefix string, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := fieldName(sf)
+		if !ok {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("json") == "" && sf.Type.Kind() == reflect.Struct {
+			if err := checkStructTags(sf.Type, prefix, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		name = prefix + name
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				if err := checkRule(sf.Type, name, rule); err != nil {
+					return err
+				}
+			}
+		}
+		if err := checkStructTags(sf.Type, name+".", seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRule returns an error if the rule is malformed or does not apply to fields of the type.
+func checkRule(t reflect.Type, name, rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || rule == "required" {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid validation rule %q for field %v", rule, name)
+	}
+	switch parts[0] {
+	case "min", "max":
+		if _, err := strconv.ParseFloat(parts[1], 64); err != nil {
+			return fmt.Errorf("invalid validation rule %q for field %v", rule, name)
+		}
+		if !measurable(t) {
+			return fmt.Errorf("invalid validation rule %q for field %v: unsupported type %v", rule, name, t)
+		}
+	case "oneof":
+		if len(strings.Fields(parts[1])) == 0 {
+			return fmt.Errorf("invalid validation rule %q for field %v", rule, name)
+		}
+	default:
+		return fmt.Errorf("invalid validation rule %q for field %v", rule, name)
+	}
+	return nil
+}
+
+// measurable tells whether min/max rules apply to values of the type.
+func measurable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// measure returns a number that min/max rules compare with: the value itself for numbers and
+// the length for strings, slices and maps.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	default:
+		return float64(v.Len()), true
+	}
+}
@@ -0,0 +1,271 @@
+package scroll
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type DecodeSuite struct {
+	app *App
+}
+
+var _ = Suite(&DecodeSuite{})
+
+type testAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type testRequest struct {
+	Name    string       `json:"name" validate:"required,max=5"`
+	Limit   int          `json:"limit" validate:"min=1,max=100"`
+	Sort    string       `json:"sort" validate:"oneof=asc desc"`
+	Tags    []string     `json:"tags"`
+	Address *testAddress `json:"address"`
+}
+
+func (r *testRequest) Validate() error {
+	if r.Name == "admin" {
+		return ConflictError{"name is reserved"}
+	}
+	return nil
+}
+
+func (s *DecodeSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+}
+
+func (s *DecodeSuite) serve(c *C, spec Spec, contentType, body string) (int, Response) {
+	spec.JSONRequest = testRequest{}
+	if spec.JSONHandler == nil {
+		spec.JSONHandler = func(w http.ResponseWriter, r *http.Request, params map[string]string, body interface{}) (interface{}, error) {
+			req := body.(*testRequest)
+			return Response{"name": req.Name, "limit": req.Limit, "tags": req.Tags}, nil
+		}
+	}
+	r := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	MakeJSONHandler(s.app, spec.JSONHandler, spec)(w, r)
+
+	var response Response
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &response), IsNil)
+	return w.Code, response
+}
+
+func (s *DecodeSuite) TestJSON(c *C) {
+	status, response := s.serve(c, Spec{}, "application/json; charset=utf-8",
+		`{"name": "bob", "limit": 10, "sort": "asc", "tags": ["a", "b"]}`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response, DeepEquals, Response{"name": "bob", "limit": float64(10), "tags": []interface{}{"a", "b"}})
+}
+
+func (s *DecodeSuite) TestForm(c *C) {
+	status, response := s.serve(c, Spec{}, "application/x-www-form-urlencoded", "name=bob&limit=10&tags=a&tags=b")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response, DeepEquals, Response{"name": "bob", "limit": float64(10), "tags": []interface{}{"a", "b"}})
+
+	status, response = s.serve(c, Spec{}, "application/x-www-form-urlencoded", "name=bob&limit=ten")
+	c.Assert(status, Equals, http.StatusBadRequest)
+	c.Assert(response["message"], Equals, InvalidFormatError{"limit", "ten"}.Error())
+}
+
+func (s *DecodeSuite) TestErrors(c *C) {
+	for i, tc := range []struct {
+		contentType string
+		body        string
+		status      int
+		err         error
+	}{{
+		contentType: "application/json",
+		body:        `{"limit": 10}`,
+		status:      http.StatusBadRequest,
+		err:         MissingFieldError{"name"},
+	}, {
+		contentType: "",
+		body:        ``,
+		status:      http.StatusBadRequest,
+		err:         MissingFieldError{"name"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "bob", "limit": "ten"}`,
+		status:      http.StatusBadRequest,
+		err:         InvalidFormatError{"limit", "string"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "bob"`,
+		status:      http.StatusBadRequest,
+		err:         InvalidFormatError{"body", "unexpected end of JSON input"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "robert"}`,
+		status:      http.StatusBadRequest,
+		err:         InvalidParameterError{"name", "length must be at most 5"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "bob", "limit": 1000}`,
+		status:      http.StatusBadRequest,
+		err:         InvalidParameterError{"limit", "must be at most 100"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "bob", "sort": "up"}`,
+		status:      http.StatusBadRequest,
+		err:         InvalidParameterError{"sort", "must be one of [asc desc]"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "bob", "address": {}}`,
+		status:      http.StatusBadRequest,
+		err:         MissingFieldError{"address.city"},
+	}, {
+		contentType: "application/json",
+		body:        `{"name": "admin"}`,
+		status:      http.StatusConflict,
+		err:         ConflictError{"name is reserved"},
+	}, {
+		contentType: "text/plain",
+		body:        `name`,
+		status:      http.StatusBadRequest,
+		err:         InvalidParameterError{"Content-Type", "text/plain"},
+	}} {
+		c.Logf("Test case #%d", i)
+		status, response := s.serve(c, Spec{}, tc.contentType, tc.body)
+		c.Assert(status, Equals, tc.status)
+		c.Assert(response["message"], Equals, tc.err.Error())
+	}
+}
+
+type testCounter struct {
+	Count   int  `json:"count" validate:"required,min=1"`
+	Enabled bool `json:"enabled" validate:"required"`
+}
+
+// Required fields are the ones that must be provided, whether their values are zero or not.
+func (s *DecodeSuite) TestRequiredZeroValues(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods:     []string{"POST"},
+		Paths:       []string{"/counters"},
+		JSONRequest: testCounter{},
+		JSONHandler: func(w http.ResponseWriter, r *http.Request, params map[string]string, body interface{}) (interface{}, error) {
+			return body, nil
+		},
+	}), IsNil)
+
+	for i, tc := range []struct {
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{{
+		contentType: "application/json",
+		body:        `{"count": 1, "enabled": false}`,
+		status:      http.StatusOK,
+	}, {
+		contentType: "application/x-www-form-urlencoded",
+		body:        "count=1&enabled=false",
+		status:      http.StatusOK,
+	}, {
+		contentType: "application/json",
+		body:        `{"count": 1}`,
+		status:      http.StatusBadRequest,
+		message:     MissingFieldError{"enabled"}.Error(),
+	}, {
+		contentType: "application/json",
+		body:        `{"count": null, "enabled": true}`,
+		status:      http.StatusBadRequest,
+		message:     MissingFieldError{"count"}.Error(),
+	}, {
+		contentType: "application/json",
+		body:        `{"count": 0, "enabled": true}`,
+		status:      http.StatusBadRequest,
+		message:     InvalidParameterError{"count", "must be at least 1"}.Error(),
+	}} {
+		c.Logf("Test case #%d", i)
+		r := httptest.NewRequest("POST", "/counters", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		app.GetHandler().ServeHTTP(w, r)
+		c.Assert(w.Code, Equals, tc.status)
+		if tc.message != "" {
+			var response Response
+			c.Assert(json.Unmarshal(w.Body.Bytes(), &response), IsNil)
+			c.Assert(response["message"], Equals, tc.message)
+		}
+	}
+}
+
+// Malformed validation rules are reported when handlers are added rather than failing requests.
+func (s *DecodeSuite) TestInvalidRules(c *C) {
+	type nested struct {
+		Sort string `json:"sort" validate:"oneof="`
+	}
+	for i, tc := range []struct {
+		request interface{}
+		err     string
+	}{{
+		request: struct {
+			Limit int `json:"limit" validate:"min=ten"`
+		}{},
+		err: `invalid validation rule "min=ten" for field limit`,
+	}, {
+		request: struct {
+			Name string `json:"name" validate:"required,unique"`
+		}{},
+		err: `invalid validation rule "unique" for field name`,
+	}, {
+		request: struct {
+			Active bool `json:"active" validate:"max=1"`
+		}{},
+		err: `invalid validation rule "max=1" for field active: unsupported type bool`,
+	}, {
+		request: &struct {
+			Items []nested `json:"items"`
+		}{},
+		err: `invalid validation rule "oneof=" for field items.sort`,
+	}} {
+		c.Logf("Test case #%d", i)
+		c.Assert(s.app.AddHandler(Spec{
+			Methods:     []string{"POST"},
+			Paths:       []string{"/invalid"},
+			JSONRequest: tc.request,
+			JSONHandler: func(http.ResponseWriter, *http.Request, map[string]string, interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		}), ErrorMatches, regexp.QuoteMeta(tc.err))
+		c.Assert(s.app.AddHandler(Spec{
+			Methods:      []string{"POST"},
+			Paths:        []string{"/invalid"},
+			BatchItem:    tc.request,
+			BatchHandler: func(*http.Request, map[string]string, interface{}) (interface{}, error) { return nil, nil },
+		}), ErrorMatches, regexp.QuoteMeta(tc.err))
+	}
+}
+
+func (s *DecodeSuite) TestMaxBodySize(c *C) {
+	status, response := s.serve(c, Spec{MaxBodySize: 10}, "application/json", `{"name": "bob"}`)
+	c.Assert(status, Equals, http.StatusBadRequest)
+	c.Assert(response["message"], Equals, InvalidParameterError{"body", "is larger than 10 bytes"}.Error())
+}
+
+func (s *DecodeSuite) TestHandlerError(c *C) {
+	spec := Spec{
+		JSONHandler: func(w http.ResponseWriter, r *http.Request, params map[string]string, body interface{}) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+	}
+	status, response := s.serve(c, spec, "application/json", `{"name": "bob"}`)
+	c.Assert(status, Equals, http.StatusInternalServerError)
+	c.Assert(response["message"], Equals, "Internal Server Error")
+}
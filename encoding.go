@@ -0,0 +1,490 @@
+package scroll
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Media types of the encoders that every app supports out of the box.
+const (
+	MediaTypeJSON       = "application/json"
+	MediaTypePrettyJSON = "application/json; pretty=true"
+	MediaTypeMsgpack    = "application/msgpack"
+	MediaTypeCSV        = "text/csv"
+	MediaTypeText       = "text/plain"
+	MediaTypeNDJSON     = "application/x-ndjson"
+)
+
+// Encoder serializes responses returned by handlers into a particular media type.
+type Encoder interface {
+	// ContentType returns the Content-Type header value of the responses made by the encoder.
+	ContentType() string
+
+	// Encode writes the encoded value to the writer.
+	Encode(w io.Writer, v interface{}) error
+}
+
+// JSONEncoder encodes responses as JSON, indenting them with Indent if it is not empty.
+type JSONEncoder struct {
+	Indent string
+}
+
+func (e JSONEncoder) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (e JSONEncoder) Encode(w io.Writer, v interface{}) error {
+	var data []byte
+	var err error
+	if e.Indent == "" {
+		data, err = json.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", e.Indent)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// MsgpackEncoder encodes responses as MessagePack. Values are converted the same way they would be
+// to JSON, so `json` struct tags and json.Marshaler implementations are respected.
+type MsgpackEncoder struct{}
+
+func (e MsgpackEncoder) ContentType() string {
+	return MediaTypeMsgpack
+}
+
+func (e MsgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeMsgpack(&buf, generic)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// NDJSONEncoder encodes responses as newline delimited JSON. A list is encoded as a line per element,
+// and anything else as a single line.
+type NDJSONEncoder struct{}
+
+func (e NDJSONEncoder) ContentType() string {
+	return MediaTypeNDJSON
+}
+
+func (e NDJSONEncoder) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	lines, ok := generic.([]interface{})
+	if !ok {
+		lines = []interface{}{generic}
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// CSVEncoder encodes responses as CSV. A list is encoded as a row per element, and anything else
+// as a single row. Columns are named after the keys of the encoded objects, in alphabetical order.
+type CSVEncoder struct{}
+
+func (e CSVEncoder) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (e CSVEncoder) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	rows, ok := generic.([]interface{})
+	if !ok {
+		rows = []interface{}{generic}
+	}
+
+	// Collect the columns from all rows, so that rows with missing keys can still be encoded.
+	columnSet := map[string]bool{}
+	for _, row := range rows {
+		if obj, ok := row.(map[string]interface{}); ok {
+			for k := range obj {
+				columnSet[k] = true
+			}
+		} else {
+			columnSet["value"] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for k := range columnSet {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		obj, ok := row.(map[string]interface{})
+		if !ok {
+			obj = map[string]interface{}{"value": row}
+		}
+		for i, column := range columns {
+			record[i] = textValue(obj[column])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// TextEncoder encodes responses as plain text. Strings and fmt.Stringer values are written as is,
+// a response with just a message is written as the message, objects are written as a "key: value"
+// line per key and lists as a line per element.
+type TextEncoder struct{}
+
+func (e TextEncoder) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (e TextEncoder) Encode(w io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		_, err := io.WriteString(w, v)
+		return err
+	case []byte:
+		_, err := w.Write(v)
+		return err
+	case fmt.Stringer:
+		_, err := io.WriteString(w, v.String())
+		return err
+	}
+
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	switch generic := generic.(type) {
+	case map[string]interface{}:
+		if message, ok := generic["message"]; ok && len(generic) == 1 {
+			buf.WriteString(textValue(message))
+			break
+		}
+		keys := make([]string, 0, len(generic))
+		for k := range generic {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s: %s\n", k, textValue(generic[k]))
+		}
+	case []interface{}:
+		for _, item := range generic {
+			fmt.Fprintln(&buf, textValue(item))
+		}
+	default:
+		buf.WriteString(textValue(generic))
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// toGeneric converts the value into a tree of maps, slices and scalars, the same way it would be
+// represented in JSON. Numbers are represented with json.Number.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// textValue formats a generic value as a single line of text. Objects and lists are formatted as JSON.
+func textValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// encoderEntry is an encoder registered for a media type.
+type encoderEntry struct {
+	mediaType string
+	params    map[string]string
+	encoder   Encoder
+}
+
+// encoderRegistry selects encoders for requests based on their Accept header.
+type encoderRegistry struct {
+	mu      sync.RWMutex
+	entries []encoderEntry
+}
+
+func newEncoderRegistry() *encoderRegistry {
+	er := &encoderRegistry{}
+	er.register(MediaTypeJSON, JSONEncoder{})
+	er.register(MediaTypePrettyJSON, JSONEncoder{Indent: "  "})
+	er.register(MediaTypeMsgpack, MsgpackEncoder{})
+	er.register("application/x-msgpack", MsgpackEncoder{})
+	er.register(MediaTypeCSV, CSVEncoder{})
+	er.register(MediaTypeText, TextEncoder{})
+	er.register(MediaTypeNDJSON, NDJSONEncoder{})
+	return er
+}
+
+// register adds an encoder for the media type replacing the one that was registered for it before.
+func (er *encoderRegistry) register(mediaType string, encoder Encoder) error {
+	mt, params, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return fmt.Errorf("invalid media type %q: %v", mediaType, err)
+	}
+	entry := encoderEntry{mediaType: mt, params: params, encoder: encoder}
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	for i, e := range er.entries {
+		if e.mediaType == entry.mediaType && equalParams(e.params, entry.params) {
+			er.entries[i] = entry
+			return nil
+		}
+	}
+	er.entries = append(er.entries, entry)
+	return nil
+}
+
+// defaultEncoder returns the encoder used when a request does not specify what it accepts, which is
+// the encoder registered first.
+func (er *encoderRegistry) defaultEncoder() Encoder {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	if len(er.entries) == 0 {
+		return JSONEncoder{}
+	}
+	return er.entries[0].encoder
+}
+
+// negotiate returns the encoder for the most preferred media type in the Accept header value.
+// Media types are excluded by ranges with zero quality, e.g. "application/json;q=0, */*" accepts
+// anything but JSON. Returns `NotAcceptableError` if none of the accepted media types has an encoder.
+func (er *encoderRegistry) negotiate(accept string) (Encoder, error) {
+	if strings.TrimSpace(accept) == "" {
+		return er.defaultEncoder(), nil
+	}
+
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	ranges := parseAccept(accept)
+	for _, ar := range ranges {
+		if ar.quality <= 0 {
+			break
+		}
+		var best *encoderEntry
+		for i := range er.entries {
+			e := &er.entries[i]
+			if !ar.matches(e) || excluded(e, ranges) {
+				continue
+			}
+			// Prefer the entry that matches most of the requested parameters, and the one registered
+			// first among equals.
+			if best == nil || len(e.params) > len(best.params) {
+				best = e
+			}
+		}
+		if best != nil {
+			return best.encoder, nil
+		}
+	}
+	return nil, NotAcceptableError{accept}
+}
+
+// acceptable tells whether the Accept header value accepts the media type, for responses that are
+// written in a media type of their own rather than by the negotiated encoder, e.g. streams.
+func (er *encoderRegistry) acceptable(accept, mediaType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	mt, params, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return false
+	}
+	e := &encoderEntry{mediaType: mt, params: params}
+	ranges := parseAccept(accept)
+	for _, ar := range ranges {
+		if ar.quality <= 0 {
+			break
+		}
+		if ar.matches(e) {
+			return !excluded(e, ranges)
+		}
+	}
+	return false
+}
+
+// excluded tells whether the media type of the encoder entry is not acceptable, because the most
+// specific of the ranges that include it has zero quality.
+func excluded(e *encoderEntry, ranges []acceptRange) bool {
+	var closest *acceptRange
+	for i := range ranges {
+		ar := &ranges[i]
+		if !ar.includes(e) {
+			continue
+		}
+		if closest == nil || specificity(ar.mediaType) > specificity(closest.mediaType) ||
+			specificity(ar.mediaType) == specificity(closest.mediaType) && len(ar.params) > len(closest.params) {
+			closest = ar
+		}
+	}
+	return closest != nil && closest.quality <= 0
+}
+
+// negotiateEncoder returns the encoder for the request like encoderRegistry.negotiate, and adds
+// Accept to the Vary header of the response, because the response depends on it.
+func (app *App) negotiateEncoder(w http.ResponseWriter, r *http.Request) (Encoder, error) {
+	addVary(w.Header(), "Accept")
+	return app.encoders.negotiate(r.Header.Get("Accept"))
+}
+
+// addVary adds the request header to the Vary header unless it is listed already.
+func addVary(h http.Header, header string) {
+	for _, value := range h["Vary"] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), header) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", header)
+}
+
+// acceptRange is a single media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	params    map[string]string
+	quality   float64
+}
+
+// matches tells whether the media range includes the media type of the encoder entry. Parameters of
+// the entry must be present in the range, while the range may have parameters the entry does not.
+func (ar acceptRange) matches(e *encoderEntry) bool {
+	switch {
+	case ar.mediaType == "*/*":
+	case strings.HasSuffix(ar.mediaType, "/*"):
+		if !strings.HasPrefix(e.mediaType, strings.TrimSuffix(ar.mediaType, "*")) {
+			return false
+		}
+	case ar.mediaType != e.mediaType:
+		return false
+	}
+	for k, v := range e.params {
+		if !strings.EqualFold(ar.params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// includes tells whether the media type of the encoder entry is in the media range. Unlike matches,
+// it is the parameters of the range that must be present in the entry, so "application/json" includes
+// "application/json; pretty=true".
+func (ar acceptRange) includes(e *encoderEntry) bool {
+	if !ar.matches(&encoderEntry{mediaType: e.mediaType}) {
+		return false
+	}
+	for k, v := range ar.params {
+		if !strings.EqualFold(e.params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAccept parses the Accept header value into media ranges ordered by preference, so ranges
+// with zero quality come last. Malformed ranges are skipped.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		ar := acceptRange{mediaType: mt, params: params, quality: 1}
+		if q, ok := params["q"]; ok {
+			delete(params, "q")
+			if ar.quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, ar)
+	}
+	// More specific ranges take precedence over wildcards of the same quality.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+	return ranges
+}
+
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func equalParams(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
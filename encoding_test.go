@@ -0,0 +1,152 @@
+package scroll
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncodingSuite struct {
+	app *App
+}
+
+var _ = Suite(&EncodingSuite{})
+
+func (s *EncodingSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *EncodingSuite) SetUpTest(c *C) {
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+}
+
+func (s *EncodingSuite) serve(accept string, response interface{}) *httptest.ResponseRecorder {
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return response, nil
+	}
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	MakeHandler(s.app, fn, Spec{})(w, r)
+	return w
+}
+
+func (s *EncodingSuite) TestNegotiation(c *C) {
+	response := []Response{{"id": 1, "name": "foo"}, {"id": 2, "name": "bar, baz"}}
+	for i, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{{
+		accept:      "",
+		contentType: "application/json; charset=utf-8",
+		body:        `[{"id":1,"name":"foo"},{"id":2,"name":"bar, baz"}]`,
+	}, {
+		accept:      "text/html,application/xhtml+xml,*/*;q=0.8",
+		contentType: "application/json; charset=utf-8",
+		body:        `[{"id":1,"name":"foo"},{"id":2,"name":"bar, baz"}]`,
+	}, {
+		accept:      "application/json; pretty=true",
+		contentType: "application/json; charset=utf-8",
+		body:        "[\n  {\n    \"id\": 1,\n    \"name\": \"foo\"\n  },\n  {\n    \"id\": 2,\n    \"name\": \"bar, baz\"\n  }\n]",
+	}, {
+		accept:      "application/json;q=0.5, text/csv",
+		contentType: "text/csv; charset=utf-8",
+		body:        "id,name\n1,foo\n2,\"bar, baz\"\n",
+	}, {
+		accept:      "text/*",
+		contentType: "text/csv; charset=utf-8",
+		body:        "id,name\n1,foo\n2,\"bar, baz\"\n",
+	}, {
+		accept:      "text/plain",
+		contentType: "text/plain; charset=utf-8",
+		body:        "{\"id\":1,\"name\":\"foo\"}\n{\"id\":2,\"name\":\"bar, baz\"}\n",
+	}, {
+		accept:      "application/msgpack",
+		contentType: "application/msgpack",
+		body:        "\x92\x82\xa2id\x01\xa4name\xa3foo\x82\xa2id\x02\xa4name\xa8bar, baz",
+	}, {
+		accept:      "application/json;q=0, */*",
+		contentType: "application/msgpack",
+		body:        "\x92\x82\xa2id\x01\xa4name\xa3foo\x82\xa2id\x02\xa4name\xa8bar, baz",
+	}, {
+		accept:      "*/*;q=0, text/plain;q=0.1",
+		contentType: "text/plain; charset=utf-8",
+		body:        "{\"id\":1,\"name\":\"foo\"}\n{\"id\":2,\"name\":\"bar, baz\"}\n",
+	}, {
+		accept:      "application/xml",
+		contentType: "application/json; charset=utf-8",
+		body:        `{"message":"None of the accepted media types is supported: application/xml","request_id":"test"}`,
+	}} {
+		c.Logf("Test case #%d", i)
+		w := s.serve(tc.accept, response)
+		c.Assert(w.Header().Get("Content-Type"), Equals, tc.contentType)
+		c.Assert(w.Header().Get("Vary"), Equals, "Accept")
+		c.Assert(w.Body.String(), Equals, tc.body)
+	}
+}
+
+func (s *EncodingSuite) TestNotAcceptable(c *C) {
+	called := false
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		called = true
+		return Response{}, nil
+	}
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.Header.Set("Accept", "application/xml, application/json;q=0")
+	w := httptest.NewRecorder()
+	MakeHandler(s.app, fn, Spec{})(w, r)
+
+	c.Assert(w.Code, Equals, http.StatusNotAcceptable)
+	c.Assert(called, Equals, false)
+}
+
+func (s *EncodingSuite) TestTextMessage(c *C) {
+	w := s.serve("text/plain", Response{"message": "Hello World"})
+	c.Assert(w.Body.String(), Equals, "Hello World")
+}
+
+func (s *EncodingSuite) TestRegisterEncoder(c *C) {
+	c.Assert(s.app.RegisterEncoder("application/json", JSONEncoder{Indent: "\t"}), IsNil)
+	c.Assert(s.app.RegisterEncoder("not a media type", JSONEncoder{}), NotNil)
+
+	w := s.serve("", Response{"id": 1})
+	c.Assert(w.Body.String(), Equals, "{\n\t\"id\": 1\n}")
+}
+
+func (s *EncodingSuite) TestMsgpackNumbers(c *C) {
+	for i, tc := range []struct {
+		value interface{}
+		bytes []byte
+	}{
+		{value: -1, bytes: []byte{0xff}},
+		{value: 200, bytes: []byte{0xcc, 0xc8}},
+		{value: -200, bytes: []byte{0xd1, 0xff, 0x38}},
+		{value: 70000, bytes: []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{value: 1.5, bytes: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{value: nil, bytes: []byte{0xc0}},
+		{value: true, bytes: []byte{0xc3}},
+	} {
+		c.Logf("Test case #%d", i)
+		var buf bytes.Buffer
+		c.Assert(MsgpackEncoder{}.Encode(&buf, tc.value), IsNil)
+		c.Assert(buf.Bytes(), DeepEquals, tc.bytes)
+	}
+}
+
+func (s *EncodingSuite) TestNDJSON(c *C) {
+	w := s.serve("application/x-ndjson", []Response{{"id": 1}, {"id": 2}})
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/x-ndjson")
+	c.Assert(w.Body.String(), Equals, "{\"id\":1}\n{\"id\":2}\n")
+
+	w = s.serve("application/x-ndjson", Response{"id": 1})
+	c.Assert(w.Body.String(), Equals, "{\"id\":1}\n")
+}
@@ -0,0 +1,204 @@
+package scroll
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ErrorStatus can be implemented by errors to pick the HTTP status code they are replied with.
+// It takes precedence over the status codes registered for errors.
+type ErrorStatus interface {
+	HTTPStatus() int
+}
+
+// ErrorHeaders can be implemented by errors to add headers to the reply, e.g. Retry-After.
+type ErrorHeaders interface {
+	HTTPHeaders() http.Header
+}
+
+// ErrorFields can be implemented by errors to add fields to the reply next to the message.
+type ErrorFields interface {
+	ResponseFields() Response
+}
+
+// ErrorFunc converts an error into a response and HTTP status code.
+type ErrorFunc func(err error) (Response, int)
+
+// The registry of the package, used by ReplyError and the apps as a fallback for errors they do
+// not have their own mapping for.
+var defaultErrors = newErrorRegistry(nil)
+
+func init() {
+	defaultErrors.register((*GenericAPIError)(nil), messageFunc(http.StatusBadRequest))
+	defaultErrors.register((*MissingFieldError)(nil), messageFunc(http.StatusBadRequest))
+	defaultErrors.register((*InvalidFormatError)(nil), messageFunc(http.StatusBadRequest))
+	defaultErrors.register((*InvalidParameterError)(nil), messageFunc(http.StatusBadRequest))
+	defaultErrors.register((*UnsafeFieldError)(nil), messageFunc(http.StatusBadRequest))
+	defaultErrors.register((*NotFoundError)(nil), messageFunc(http.StatusNotFound))
+	defaultErrors.register((*ConflictError)(nil), messageFunc(http.StatusConflict))
+	defaultErrors.register((*NotAcceptableError)(nil), messageFunc(http.StatusNotAcceptable))
+	defaultErrors.register((*RateLimitError)(nil), messageFunc(http.StatusTooManyRequests))
+	defaultErrors.register((*BatchTooLargeError)(nil), messageFunc(http.StatusRequestEntityTooLarge))
+	defaultErrors.register((*ValidationErrors)(nil), func(err error) (Response, int) {
+		return Response{"message": err.Error(), "errors": err.(ValidationErrors).Fields()}, http.StatusBadRequest
+	})
+}
+
+// RegisterError makes errors of the target type replied with the status code and the error message
+// by all apps, unless an app registers its own mapping for them.
+//
+// The target must be a pointer to an error type or to an interface that errors implement,
+// just like in errors.As, e.g.:
+//
+//  scroll.RegisterError((*UserNotFound)(nil), http.StatusNotFound)
+//  scroll.RegisterError((*Temporary)(nil), http.StatusServiceUnavailable)
+//
+// Wrapped errors are matched if any error in their chain matches the target. An error is unwrapped
+// with Cause() (github.com/pkg/errors) or Unwrap(). Errors registered later take precedence.
+func RegisterError(target interface{}, status int) {
+	defaultErrors.register(target, messageFunc(status))
+}
+
+// RegisterErrorFunc is like RegisterError, but the response and status code are made by the function.
+// The function is called with the error from the chain that matched the target.
+func RegisterErrorFunc(target interface{}, fn ErrorFunc) {
+	defaultErrors.register(target, fn)
+}
+
+// RegisterError makes errors of the target type replied with the status code and the error message
+// by the app. See the package RegisterError for details.
+func (app *App) RegisterError(target interface{}, status int) {
+	app.errors.register(target, messageFunc(status))
+}
+
+// RegisterErrorFunc is like RegisterError, but the response and status code are made by the function.
+func (app *App) RegisterErrorFunc(target interface{}, fn ErrorFunc) {
+	app.errors.register(target, fn)
+}
+
+// messageFunc makes an ErrorFunc that replies with the error message and the status code.
+func messageFunc(status int) ErrorFunc {
+	return func(err error) (Response, int) {
+		return Response{"message": err.Error()}, status
+	}
+}
+
+type errorMapping struct {
+	target reflect.Type
+	fn     ErrorFunc
+}
+
+// errorRegistry maps errors to responses. Errors it does not have a mapping for are passed to
+// the parent registry.
+type errorRegistry struct {
+	parent   *errorRegistry
+	mu       sync.RWMutex
+	mappings []errorMapping
+}
+
+func newErrorRegistry(parent *errorRegistry) *errorRegistry {
+	return &errorRegistry{parent: parent}
+}
+
+func (er *errorRegistry) register(target interface{}, fn ErrorFunc) {
+	t := reflect.TypeOf(target)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("error target must be a pointer to an error type or interface, got %v", t))
+	}
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.mappings = append(er.mappings, errorMapping{target: t.Elem(), fn: fn})
+}
+
+// lookup returns the function registered for the error type, searching the parent registries too.
+func (er *errorRegistry) lookup(err error) (ErrorFunc, bool) {
+	for r := er; r != nil; r = r.parent {
+		r.mu.RLock()
+		for i := len(r.mappings) - 1; i >= 0; i-- {
+			if reflect.TypeOf(err).AssignableTo(r.mappings[i].target) {
+				r.mu.RUnlock()
+				return r.mappings[i].fn, true
+			}
+		}
+		r.mu.RUnlock()
+	}
+	return nil, false
+}
+
+// resolve converts the error into a response, status code and headers. It also returns the error
+// from the chain that determined the reply, or nil if none did.
+//
+// The errors in the chain are checked from the outermost one, and the first error that either
+// implements ErrorStatus or has a registered mapping determines the reply. If none does,
+// the reply is an opaque "Internal Server Error", so that details of unexpected failures are not
+// revealed to clients. Headers and fields supplied by the errors in the chain are added to
+// the reply, with those of the outer errors taking precedence.
+func (er *errorRegistry) resolve(err error) (Response, int, http.Header, error) {
+	chain := errorChain(err)
+
+	var matched error
+	response, status := Response{"message": "Internal Server Error"}, http.StatusInternalServerError
+	for _, e := range chain {
+		if es, ok := e.(ErrorStatus); ok {
+			response, status, matched = Response{"message": e.Error()}, es.HTTPStatus(), e
+			break
+		}
+		if fn, ok := er.lookup(e); ok {
+			response, status = fn(e)
+			matched = e
+			break
+		}
+	}
+	if response == nil {
+		response = Response{}
+	}
+
+	header := http.Header{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if eh, ok := chain[i].(ErrorHeaders); ok {
+			for k, v := range eh.HTTPHeaders() {
+				header[k] = v
+			}
+		}
+		if ef, ok := chain[i].(ErrorFields); ok {
+			for k, v := range ef.ResponseFields() {
+				response[k] = v
+			}
+		}
+	}
+	return response, status, header, matched
+}
+
+// reply converts the error into a response and status code, and sets the headers supplied by
+// the error on the response writer. The ID of the request, if known, is added to the response.
+func (er *errorRegistry) reply(w http.ResponseWriter, err error) (Response, int) {
+	response, status, header, _ := er.resolve(err)
+	setHeaders(w, header)
+	addRequestID(w, response)
+	return response, status
+}
+
+func setHeaders(w http.ResponseWriter, header http.Header) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+}
+
+// errorChain returns the error followed by the errors it wraps.
+func errorChain(err error) []error {
+	var chain []error
+	for err != nil && len(chain) < 100 {
+		chain = append(chain, err)
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			err = nil
+		}
+	}
+	return chain
+}
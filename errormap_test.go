@@ -0,0 +1,135 @@
+package scroll
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/pkg/errors"
+	. "gopkg.in/check.v1"
+)
+
+type ErrorMapSuite struct{}
+
+var _ = Suite(&ErrorMapSuite{})
+
+func (s *ErrorMapSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+type quotaError struct {
+	Used int
+}
+
+func (e quotaError) Error() string {
+	return "quota exceeded"
+}
+
+func (e quotaError) HTTPStatus() int {
+	return http.StatusPaymentRequired
+}
+
+func (e quotaError) HTTPHeaders() http.Header {
+	return http.Header{"Retry-After": []string{"3600"}}
+}
+
+func (e quotaError) ResponseFields() Response {
+	return Response{"used": e.Used}
+}
+
+type temporary interface {
+	Temporary() bool
+}
+
+type backendError struct{}
+
+func (e *backendError) Error() string {
+	return "backend is down"
+}
+
+func (e *backendError) Temporary() bool {
+	return true
+}
+
+type accountError struct {
+	Account string
+}
+
+func (e accountError) Error() string {
+	return "account is disabled"
+}
+
+func (s *ErrorMapSuite) reply(app *App, err error) *httptest.ResponseRecorder {
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return nil, err
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	w := httptest.NewRecorder()
+	MakeHandler(app, fn, Spec{})(w, r)
+	return w
+}
+
+func (s *ErrorMapSuite) TestResolve(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	app.RegisterError((*temporary)(nil), http.StatusServiceUnavailable)
+	app.RegisterErrorFunc((*accountError)(nil), func(err error) (Response, int) {
+		return Response{"message": err.Error(), "account": err.(accountError).Account}, http.StatusForbidden
+	})
+	app.RegisterError((*ConflictError)(nil), http.StatusPreconditionFailed)
+
+	for i, tc := range []struct {
+		err    error
+		status int
+		body   string
+		header http.Header
+	}{{
+		err:    NotFoundError{"no such user"},
+		status: http.StatusNotFound,
+		body:   `{"message":"no such user","request_id":"test"}`,
+	}, {
+		err:    errors.Wrap(NotFoundError{"no such user"}, "while fetching user"),
+		status: http.StatusNotFound,
+		body:   `{"message":"no such user","request_id":"test"}`,
+	}, {
+		err:    errors.Wrap(&backendError{}, "while fetching user"),
+		status: http.StatusServiceUnavailable,
+		body:   `{"message":"backend is down","request_id":"test"}`,
+	}, {
+		err:    accountError{"acme"},
+		status: http.StatusForbidden,
+		body:   `{"account":"acme","message":"account is disabled","request_id":"test"}`,
+	}, {
+		err:    ConflictError{"already exists"},
+		status: http.StatusPreconditionFailed,
+		body:   `{"message":"already exists","request_id":"test"}`,
+	}, {
+		err:    errors.WithMessage(quotaError{42}, "while sending"),
+		status: http.StatusPaymentRequired,
+		body:   `{"message":"quota exceeded","request_id":"test","used":42}`,
+		header: http.Header{"Retry-After": []string{"3600"}},
+	}, {
+		err:    errors.New("database is on fire"),
+		status: http.StatusInternalServerError,
+		body:   `{"message":"Internal Server Error","request_id":"test"}`,
+	}} {
+		c.Logf("Test case #%d", i)
+		w := s.reply(app, tc.err)
+		c.Assert(w.Code, Equals, tc.status)
+		c.Assert(w.Body.String(), Equals, tc.body)
+		for k := range tc.header {
+			c.Assert(w.Header().Get(k), Equals, tc.header.Get(k))
+		}
+	}
+
+	// Mappings registered for an app do not affect other apps.
+	other, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	w := s.reply(other, ConflictError{"already exists"})
+	c.Assert(w.Code, Equals, http.StatusConflict)
+}
+
+func (s *ErrorMapSuite) TestRegisterInvalidTarget(c *C) {
+	c.Assert(func() { RegisterError(NotFoundError{}, http.StatusNotFound) }, PanicMatches, "error target must be a pointer.*")
+}
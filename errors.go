@@ -2,7 +2,7 @@ package scroll
 
 import (
 	"fmt"
-	"net/http"
+	"strings"
 )
 
 type GenericAPIError struct {
@@ -72,17 +72,65 @@ func (e RateLimitError) Error() string {
 	return fmt.Sprintf("Rate Limited: %v. Try again later (and slower).", e.Description)
 }
 
-func responseAndStatusFor(err error) (Response, int) {
-	switch err.(type) {
-	case GenericAPIError, MissingFieldError, InvalidFormatError, InvalidParameterError, UnsafeFieldError:
-		return Response{"message": err.Error()}, http.StatusBadRequest
-	case NotFoundError:
-		return Response{"message": err.Error()}, http.StatusNotFound
-	case ConflictError:
-		return Response{"message": err.Error()}, http.StatusConflict
-	case RateLimitError:
-		return Response{"message": err.Error()}, 429 // temporary until we upgrade to Go 1.6 and can use http.StatusTooManyRequests
-	default:
-		return Response{"message": "Internal Server Error"}, http.StatusInternalServerError
+type NotAcceptableError struct {
+	Accept string
+}
+
+func (e NotAcceptableError) Error() string {
+	return fmt.Sprintf("None of the accepted media types is supported: %v", e.Accept)
+}
+
+type BatchTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e BatchTooLargeError) Error() string {
+	return fmt.Sprintf("Batch of %v items exceeds the limit of %v items", e.Size, e.MaxSize)
+}
+
+// ValidationErrors holds the errors of all the request fields that failed validation, e.g. as
+// collected by FieldValidator. It is replied with a 400 status code and a list of the failed fields.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("Invalid parameters: %v", strings.Join(messages, "; "))
+}
+
+// Fields returns a description of every failed field: its name, if known, and the error message.
+func (e ValidationErrors) Fields() []Response {
+	fields := make([]Response, len(e))
+	for i, err := range e {
+		fields[i] = Response{"message": err.Error()}
+		if field := fieldOf(err); field != "" {
+			fields[i]["field"] = field
+		}
 	}
+	return fields
+}
+
+// fieldOf returns the name of the field the error is about, or an empty string if unknown.
+func fieldOf(err error) string {
+	switch e := err.(type) {
+	case MissingFieldError:
+		return e.Field
+	case InvalidFormatError:
+		return e.Field
+	case InvalidParameterError:
+		return e.Field
+	case UnsafeFieldError:
+		return e.Field
+	}
+	return ""
+}
+
+// responseAndStatusFor converts the error into a response and HTTP status code using the errors
+// registered in the package default registry.
+func responseAndStatusFor(err error) (Response, int) {
+	response, status, _, _ := defaultErrors.resolve(err)
+	return response, status
 }
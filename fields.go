@@ -105,18 +105,24 @@ func GetTimestampField(r *http.Request, fieldName string) (time.Time, error) {
 	if _, ok := r.Form[fieldName]; !ok {
 		return time.Now(), MissingFieldError{fieldName}
 	}
-	parsedTime, err := time.Parse(time.RFC1123, r.FormValue(fieldName))
+	parsedTime, err := parseTimestamp(r.FormValue(fieldName))
 	if err != nil {
-		// Attempt to parse with offset timezone before giving up
-		parsedTime, err = time.Parse(time.RFC1123Z, r.FormValue(fieldName))
-		if err != nil {
-			log.Infof("Failed to convert timestamp %v: %v", r.FormValue(fieldName), err)
-			return time.Now(), InvalidFormatError{fieldName, r.FormValue(fieldName)}
-		}
+		log.Infof("Failed to convert timestamp %v: %v", r.FormValue(fieldName), err)
+		return time.Now(), InvalidFormatError{fieldName, r.FormValue(fieldName)}
 	}
 	return parsedTime, nil
 }
 
+// parseTimestamp parses a timestamp in the RFC1123 format, with either a timezone name or offset.
+func parseTimestamp(s string) (time.Time, error) {
+	parsedTime, err := time.Parse(time.RFC1123, s)
+	if err != nil {
+		// Attempt to parse with offset timezone before giving up
+		parsedTime, err = time.Parse(time.RFC1123Z, s)
+	}
+	return parsedTime, err
+}
+
 // GetDurationField retrieves a request field as a time.Duration, which is not allowed to be negative.
 // Returns `MissingFieldError` if requested field is missing.
 func GetDurationField(r *http.Request, fieldName string) (time.Duration, error) {
@@ -137,3 +143,124 @@ func HasField(r *http.Request, fieldName string) bool {
 	}
 	return true
 }
+
+// FieldValidator retrieves request fields collecting the errors of all missing, unsafe
+// or malformed ones, so that they can be reported to a client at once, e.g.:
+//
+//  v := scroll.NewFieldValidator(r)
+//  to := v.StringSafe("to", allowSet)
+//  limit := v.IntWithDefault("limit", scroll.DefaultLimit)
+//  ttl := v.Duration("ttl")
+//  if err := v.Err(); err != nil {
+//      return nil, err
+//  }
+//
+// The getters return zero values for the fields that failed.
+type FieldValidator struct {
+	r    *http.Request
+	errs ValidationErrors
+}
+
+// NewFieldValidator creates a validator of the request fields. The request form must be parsed,
+// which is the case in Handler and HandlerWithBody functions.
+func NewFieldValidator(r *http.Request) *FieldValidator {
+	return &FieldValidator{r: r}
+}
+
+// Check adds the error to the collected errors, unless it is nil. Use it to report custom checks.
+func (v *FieldValidator) Check(err error) {
+	if err != nil {
+		v.errs = append(v.errs, err)
+	}
+}
+
+// Err returns `ValidationErrors` with all the collected errors, or nil if there were none.
+func (v *FieldValidator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// String retrieves a field as a string, see GetStringField.
+func (v *FieldValidator) String(fieldName string) string {
+	value, err := GetStringField(v.r, fieldName)
+	v.Check(err)
+	return value
+}
+
+// StringSafe retrieves a field as a string checking it against the allowSet, see GetStringFieldSafe.
+func (v *FieldValidator) StringSafe(fieldName string, allowSet AllowSet) string {
+	value, err := GetStringFieldSafe(v.r, fieldName, allowSet)
+	v.Check(err)
+	return value
+}
+
+// Var retrieves a variable from the request path checking it against the allowSet, see GetVarSafe.
+func (v *FieldValidator) Var(variableName string, allowSet AllowSet) string {
+	value, err := GetVarSafe(v.r, variableName, allowSet)
+	v.Check(err)
+	return value
+}
+
+// Multiple retrieves fields with the same name as an array of strings, see GetMultipleFields.
+func (v *FieldValidator) Multiple(fieldName string) []string {
+	values, err := GetMultipleFields(v.r, fieldName)
+	v.Check(err)
+	return values
+}
+
+// Int retrieves a field as an integer, see GetIntField.
+func (v *FieldValidator) Int(fieldName string) int {
+	value, err := GetIntField(v.r, fieldName)
+	v.Check(err)
+	return value
+}
+
+// IntWithDefault retrieves a field as an integer, returning the default value if it is missing.
+func (v *FieldValidator) IntWithDefault(fieldName string, defaultValue int) int {
+	if !HasField(v.r, fieldName) {
+		return defaultValue
+	}
+	return v.Int(fieldName)
+}
+
+// Float retrieves a field as a float, see GetFloatField.
+func (v *FieldValidator) Float(fieldName string) float64 {
+	value, err := GetFloatField(v.r, fieldName)
+	v.Check(err)
+	return value
+}
+
+// FloatWithDefault retrieves a field as a float, returning the default value if it is missing.
+func (v *FieldValidator) FloatWithDefault(fieldName string, defaultValue float64) float64 {
+	if !HasField(v.r, fieldName) {
+		return defaultValue
+	}
+	return v.Float(fieldName)
+}
+
+// Duration retrieves a field as a time.Duration, see GetDurationField.
+func (v *FieldValidator) Duration(fieldName string) time.Duration {
+	value, err := GetDurationField(v.r, fieldName)
+	v.Check(err)
+	return value
+}
+
+// DurationWithDefault retrieves a field as a time.Duration, returning the default value if it is missing.
+func (v *FieldValidator) DurationWithDefault(fieldName string, defaultValue time.Duration) time.Duration {
+	if !HasField(v.r, fieldName) {
+		return defaultValue
+	}
+	return v.Duration(fieldName)
+}
+
+// Timestamp retrieves a field as a time.Time, see GetTimestampField.
+func (v *FieldValidator) Timestamp(fieldName string) time.Time {
+	value, err := GetTimestampField(v.r, fieldName)
+	if err != nil {
+		v.Check(err)
+		return time.Time{}
+	}
+	return value
+}
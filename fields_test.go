@@ -3,6 +3,7 @@ package scroll
 import (
 	"net/http"
 	"net/url"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -90,3 +91,56 @@ func (s *FieldsSuite) TestGetFloatField(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(value, Equals, float64(0.0000001))
 }
+
+func (s *FieldsSuite) TestFieldValidator(c *C) {
+	request, _ := http.NewRequest("GET", "http://example.com", nil)
+	request.Form = make(url.Values)
+	request.Form["name"] = []string{"foo!"}
+	request.Form["limit"] = []string{"ten"}
+	request.Form["ttl"] = []string{"1h"}
+	request.Form["ratio"] = []string{"0.5"}
+
+	v := NewFieldValidator(request)
+	name := v.StringSafe("name", NewAllowSetBytes("fo", 10))
+	limit := v.IntWithDefault("limit", DefaultLimit)
+	skip := v.IntWithDefault("skip", 0)
+	ttl := v.Duration("ttl")
+	ratio := v.FloatWithDefault("ratio", 1)
+	to := v.String("to")
+	v.Check(nil)
+	v.Check(InvalidParameterError{"ttl", "must be less than 1m"})
+
+	c.Assert(name, Equals, "")
+	c.Assert(limit, Equals, 0)
+	c.Assert(skip, Equals, 0)
+	c.Assert(ttl, Equals, time.Hour)
+	c.Assert(ratio, Equals, 0.5)
+	c.Assert(to, Equals, "")
+
+	err := v.Err()
+	c.Assert(err, DeepEquals, ValidationErrors{
+		UnsafeFieldError{"name", `character "!" (33) not allowed`},
+		InvalidFormatError{"limit", "ten"},
+		MissingFieldError{"to"},
+		InvalidParameterError{"ttl", "must be less than 1m"},
+	})
+
+	response, status := responseAndStatusFor(err)
+	c.Assert(status, Equals, http.StatusBadRequest)
+	c.Assert(response["errors"], DeepEquals, []Response{
+		{"field": "name", "message": `field "name" is unsafe: character "!" (33) not allowed`},
+		{"field": "limit", "message": "Invalid format for parameter limit: ten"},
+		{"field": "to", "message": "Missing mandatory parameter: to"},
+		{"field": "ttl", "message": "Invalid parameter: ttl must be less than 1m"},
+	})
+}
+
+func (s *FieldsSuite) TestFieldValidatorNoErrors(c *C) {
+	request, _ := http.NewRequest("GET", "http://example.com", nil)
+	request.Form = make(url.Values)
+
+	v := NewFieldValidator(request)
+	c.Assert(v.IntWithDefault("limit", DefaultLimit), Equals, DefaultLimit)
+	c.Assert(v.DurationWithDefault("ttl", time.Minute), Equals, time.Minute)
+	c.Assert(v.Err(), IsNil)
+}
@@ -1,7 +1,7 @@
 package scroll
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -15,8 +15,8 @@ import (
 	"github.com/mailgun/scroll/vulcand"
 )
 
-// When Handler or HandlerWithBody is used, this function will be called after every request with a log message.
-// If nil, defaults to github.com/mailgun/log.Infof.
+// When Handler or HandlerWithBody is used, this function will be called after every request with a log message,
+// unless the app is configured with AppConfig.RequestLog. If nil, defaults to github.com/mailgun/log.Infof.
 var LogRequest func(*http.Request, int, time.Duration, error)
 
 // Response objects that apps' handlers are advised to return.
@@ -41,13 +41,44 @@ type Spec struct {
 	RawHandler      http.HandlerFunc
 	Handler         HandlerFunc
 	HandlerWithBody HandlerWithBodyFunc
+	JSONHandler     JSONHandlerFunc
+	BatchHandler    BatchHandlerFunc
 
-	// Unique identifier used when emitting performance metrics for the handler.
+	// A value of the type that request bodies are decoded into for JSONHandler, e.g. CreateUser{}.
+	// It is only used to determine the type, so its contents do not matter.
+	JSONRequest interface{}
+
+	// A value of the type that batch items are decoded into for BatchHandler, e.g. Event{}.
+	// It is only used to determine the type, so its contents do not matter.
+	BatchItem interface{}
+
+	// Name of the form field that holds the items of form encoded batches, "items" if not specified.
+	BatchField string
+
+	// Number of batch items processed by BatchHandler concurrently, DefaultBatchConcurrency
+	// if not specified.
+	BatchConcurrency int
+
+	// Maximum size of a request body accepted by JSONHandler and BatchHandler, DefaultMaxBodySize
+	// if not specified.
+	MaxBodySize int64
+
+	// Unique identifier used when emitting performance metrics for the handler. If not specified, it is
+	// derived from the method and path template of the matched route, e.g. "get_v3_domain_events".
 	MetricName string
 
 	// Controls the handler's accessibility via vulcan (public or protected). If not specified, public is assumed.
 	Scope Scope
 
+	// In-process middlewares to wrap the handler with, executed after the ones added with App.Use.
+	// A middleware that appears in the list earlier is executed first.
+	HandlerMiddlewares []HandlerMiddleware
+
+	// Names of the form fields and headers which values are replaced when the requests are logged by
+	// the structured request logger, e.g. passwords and API keys.
+	RedactFields  []string
+	RedactHeaders []string
+
 	// Vulcan middlewares to register with the handler. When registering, middlewares are assigned priorities
 	// according to their positions in the list: a middleware that appears in the list earlier is executed first.
 	Middlewares []vulcand.Middleware
@@ -70,6 +101,70 @@ func DecodeParams(src map[string]string) map[string]string {
 	return results
 }
 
+// HandlerResult is a response of a handler function that needs a status code other than 200,
+// headers or cookies, e.g.:
+//
+//  return scroll.HandlerResult{
+//      Status:  http.StatusCreated,
+//      Headers: http.Header{"Location": {"/users/" + user.ID}},
+//      Body:    user,
+//  }, nil
+//
+// Handlers returning it keep the request logging, stats and content negotiation, unlike raw handlers.
+type HandlerResult struct {
+	// HTTP status code to reply with, 200 if not specified.
+	Status int
+
+	// Headers to add to the response, e.g. Location or ETag.
+	Headers http.Header
+
+	// Cookies to set.
+	Cookies []*http.Cookie
+
+	// JSON marshallable response body or a *Stream, just like the responses of handler functions.
+	// It is not written for statuses that do not allow a body, e.g. 204 No Content.
+	Body interface{}
+}
+
+func (r *HandlerResult) status() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+// apply sets the headers and cookies of the result on the response and returns the body.
+func (r *HandlerResult) apply(w http.ResponseWriter) interface{} {
+	for key, values := range r.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	for _, cookie := range r.Cookies {
+		http.SetCookie(w, cookie)
+	}
+	return r.Body
+}
+
+// setContentType sets the Content-Type header of the response unless it has been set already, e.g.
+// with the headers of a HandlerResult.
+func setContentType(w http.ResponseWriter, contentType string) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+}
+
+// bodyAllowed tells whether a response with the status code may have a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status < 200:
+		return false
+	case status == http.StatusNoContent || status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
 // Defines the signature of a handler function that can be registered by an app.
 //
 // The 3rd parameter is a map of variables extracted from the request path, e.g. if a request path was:
@@ -79,36 +174,24 @@ func DecodeParams(src map[string]string) map[string]string {
 // then the map will contain the resource ID value:
 //  {"resourceID": 1}
 //
-// A handler function should return a JSON marshallable object, e.g. Response.
+// A handler function should return a JSON marshallable object, e.g. Response, or a *Stream
+// to write a large number of items incrementally. To reply with a status code other than 200,
+// headers or cookies it should return a HandlerResult.
 type HandlerFunc func(http.ResponseWriter, *http.Request, map[string]string) (interface{}, error)
 
 // Wraps the provided handler function encapsulating boilerplate code so handlers do not have to
 // implement it themselves: parsing a request's form, formatting a proper JSON response, emitting
-// the request stats, etc.
+// the request stats, assigning the request ID, etc.
 func MakeHandler(app *App, fn HandlerFunc, spec Spec) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response interface{}
-		var status int
-		var err error
-
-		start := time.Now()
-		if err = parseForm(r); err != nil {
-			err = fmt.Errorf("Failed to parse request form: %v", err)
-			response = Response{"message": err.Error()}
-			status = http.StatusInternalServerError
-		} else {
-			response, err = fn(w, r, DecodeParams(mux.Vars(r)))
-			if err != nil {
-				response, status = responseAndStatusFor(err)
-			} else {
-				status = http.StatusOK
+		r = withRequestID(w, r)
+		serveRequest(app, spec, w, r, func() (interface{}, int, error) {
+			if err := parseForm(r); err != nil {
+				return formError(err)
 			}
-		}
-		elapsedTime := time.Since(start)
-		LogRequest(r, status, elapsedTime, err)
-		app.stats.TrackRequest(spec.MetricName, status, elapsedTime)
-
-		Reply(w, response, status)
+			response, err := fn(w, r, DecodeParams(mux.Vars(r)))
+			return app.handlerResult(w, response, err)
+		})
 	}
 }
 
@@ -120,41 +203,162 @@ type HandlerWithBodyFunc func(http.ResponseWriter, *http.Request, map[string]str
 // Make a handler out of HandlerWithBodyFunc, just like regular MakeHandler function.
 func MakeHandlerWithBody(app *App, fn HandlerWithBodyFunc, spec Spec) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response interface{}
-		var body []byte
-		var status int
-		var err error
-
-		start := time.Now()
-		if err = parseForm(r); err != nil {
-			err = fmt.Errorf("Failed to parse request form: %v", err)
-			response = Response{"message": err.Error()}
-			status = http.StatusInternalServerError
-			goto end
-		}
+		r = withRequestID(w, r)
+		serveRequest(app, spec, w, r, func() (interface{}, int, error) {
+			if err := parseForm(r); err != nil {
+				return formError(err)
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return bodyError(err)
+			}
+			response, err := fn(w, r, mux.Vars(r), body)
+			return app.handlerResult(w, response, err)
+		})
+	}
+}
 
-		body, err = ioutil.ReadAll(r.Body)
-		if err != nil {
-			err = fmt.Errorf("Failed to read request body: %v", err)
-			response = Response{"message": err.Error()}
-			status = http.StatusInternalServerError
-			goto end
-		}
+// Defines a signature of a handler function, just like HandlerFunc.
+//
+// In addition to the HandlerFunc a request's body decoded into a new instance of the Spec.JSONRequest
+// type is passed into this function as a 4th parameter. It is always a pointer, e.g. if the spec was:
+//  Spec{JSONRequest: CreateUser{}, JSONHandler: createUser}
+// then the handler can get the decoded request with:
+//  req := body.(*CreateUser)
+type JSONHandlerFunc func(http.ResponseWriter, *http.Request, map[string]string, interface{}) (interface{}, error)
+
+// Make a handler out of JSONHandlerFunc, just like regular MakeHandler function.
+//
+// The request body is decoded according to its Content-Type (JSON or form) and validated against
+// the `validate` struct tags of Spec.JSONRequest before the handler function is called. Requests
+// that fail to decode or validate are replied with the respective 400 error and never reach the
+// handler function.
+func MakeJSONHandler(app *App, fn JSONHandlerFunc, spec Spec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		serveRequest(app, spec, w, r, func() (interface{}, int, error) {
+			body, err := readBody(r, spec.MaxBodySize)
+			if err != nil {
+				if _, ok := err.(InvalidParameterError); ok {
+					return app.handlerResult(w, nil, err)
+				}
+				return bodyError(err)
+			}
+			// Let the form parser read the body again in case it is a form.
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err := parseForm(r); err != nil {
+				return formError(err)
+			}
+			req, err := decodeBody(r, body, spec.JSONRequest)
+			if err != nil {
+				return app.handlerResult(w, nil, err)
+			}
+			response, err := fn(w, r, DecodeParams(mux.Vars(r)), req)
+			return app.handlerResult(w, response, err)
+		})
+	}
+}
 
-		response, err = fn(w, r, mux.Vars(r), body)
-		if err != nil {
-			response, status = responseAndStatusFor(err)
+// serveRequest implements the part of request handling that is common for all handler kinds: it
+// calls the provided function, replies with the response returned by the function, logs the request
+// and emits the request stats.
+//
+// The response is encoded with the encoder matching the request Accept header. Requests that do not
+// accept any of the media types supported by the app are replied with 406 without calling the function.
+// A Stream response is written in its own format as it is iterated, so the request is logged once it
+// is over. A stream that the request does not accept is replied with 406. A panic in the function is
+// replied with the standard internal error.
+func serveRequest(app *App, spec Spec, w http.ResponseWriter, r *http.Request, fn func() (interface{}, int, error)) {
+	var response interface{}
+	var status int
+
+	start := time.Now()
+	rw := newResponseWriter(w)
+	body := &countingBody{ReadCloser: r.Body}
+	if r.Body != nil {
+		r.Body = body
+	}
+	stats := requestStats(spec, r)
+	app.stats.TrackInFlight(stats, 1)
+	defer app.stats.TrackInFlight(stats, -1)
+
+	encoder, err := app.negotiateEncoder(w, r)
+	if err != nil {
+		encoder = app.encoders.defaultEncoder()
+		response, status = app.errorResponse(w, err)
+	} else {
+		response, status, err = app.callHandler(w, r, spec, fn)
+	}
+
+	if stream, ok := response.(*Stream); ok && err == nil {
+		if accept := r.Header.Get("Accept"); !app.encoders.acceptable(accept, stream.mediaType()) {
+			err = NotAcceptableError{accept}
+			encoder = app.encoders.defaultEncoder()
+			response, status = app.errorResponse(w, err)
+		} else if err = stream.prepare(); err != nil {
+			response, status = app.errorResponse(w, err)
 		} else {
-			status = http.StatusOK
+			err = stream.writeTo(rw, status)
+			traceError(r, err)
+			elapsedTime := time.Since(start)
+			app.logRequest(spec, r, rw, status, elapsedTime, err)
+			app.stats.TrackRequest(stats, status, elapsedTime, body.bytes, rw.bytes)
+			return
 		}
+	}
 
-	end:
-		elapsedTime := time.Since(start)
-		LogRequest(r, status, elapsedTime, err)
-		app.stats.TrackRequest(spec.MetricName, status, elapsedTime)
+	reply(rw, encoder, response, status)
 
-		Reply(w, response, status)
+	traceError(r, err)
+	elapsedTime := time.Since(start)
+	app.logRequest(spec, r, rw, status, elapsedTime, err)
+	app.stats.TrackRequest(stats, status, elapsedTime, body.bytes, rw.bytes)
+}
+
+// callHandler calls the function serving the request. If it panics, the panic is logged and the request
+// is considered to fail with an internal error, unless it panics with http.ErrAbortHandler.
+func (app *App) callHandler(w http.ResponseWriter, r *http.Request, spec Spec, fn func() (interface{}, int, error)) (response interface{}, status int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			err = app.handlePanic(r, spec, p)
+			response, status = app.errorResponse(w, err)
+		}
+	}()
+	return fn()
+}
+
+// handlerResult converts the values returned by a handler function into a response and status code.
+// Errors are converted with the error mappings registered for the app. A HandlerResult is unwrapped
+// into its body and status code, and its headers and cookies are set on the response.
+func (app *App) handlerResult(w http.ResponseWriter, response interface{}, err error) (interface{}, int, error) {
+	if err != nil {
+		response, status := app.errorResponse(w, err)
+		return response, status, err
+	}
+	switch result := response.(type) {
+	case HandlerResult:
+		return result.apply(w), result.status(), nil
+	case *HandlerResult:
+		if result != nil {
+			return result.apply(w), result.status(), nil
+		}
 	}
+	return response, http.StatusOK, nil
+}
+
+// formError makes a response for a request which form could not be parsed.
+func formError(err error) (interface{}, int, error) {
+	err = fmt.Errorf("Failed to parse request form: %v", err)
+	return Response{"message": err.Error()}, http.StatusInternalServerError, err
+}
+
+// bodyError makes a response for a request which body could not be read.
+func bodyError(err error) (interface{}, int, error) {
+	err = fmt.Errorf("Failed to read request body: %v", err)
+	return Response{"message": err.Error()}, http.StatusInternalServerError, err
 }
 
 // Reply with the provided HTTP response and status code.
@@ -162,30 +366,60 @@ func MakeHandlerWithBody(app *App, fn HandlerWithBodyFunc, spec Spec) http.Handl
 // Response body must be JSON-marshallable, otherwise the response
 // will be "Internal Server Error".
 func Reply(w http.ResponseWriter, response interface{}, status int) {
-	// marshal the body of the response
-	marshalledResponse, err := json.Marshal(response)
-	if err != nil {
-		marshalledResponse = []byte(fmt.Sprintf(`{"message": "Failed to marshal response: %v %v"}`, response, err))
+	reply(w, JSONEncoder{}, response, status)
+}
+
+// reply encodes the response with the provided encoder and writes it with the status code. The body
+// is not written for statuses that do not allow one, e.g. 204 No Content.
+//
+// Problem responses are always encoded as application/problem+json. If the response can not be
+// encoded the reply is a JSON "Internal Server Error".
+func reply(w http.ResponseWriter, encoder Encoder, response interface{}, status int) {
+	if !bodyAllowed(status) {
+		w.WriteHeader(status)
+		return
+	}
+	if _, ok := response.(Problem); ok {
+		encoder = problemEncoder{}
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, response); err != nil {
+		buf.Reset()
+		buf.WriteString(fmt.Sprintf(`{"message": "Failed to marshal response: %v %v"}`, response, err))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		status = http.StatusInternalServerError
 		LogRequest(nil, status, time.Nanosecond, err)
+	} else {
+		setContentType(w, encoder.ContentType())
 	}
 
-	// write JSON response
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
-	w.Write(marshalledResponse)
+	w.Write(buf.Bytes())
 }
 
 // ReplyError converts registered error into HTTP response code and writes it back.
+//
+// Only the errors registered for the package are recognized, use App.ReplyError to also recognize
+// the errors registered for an app.
 func ReplyError(w http.ResponseWriter, err error) {
-	response, status := responseAndStatusFor(err)
+	response, status := defaultErrors.reply(w, err)
 	Reply(w, response, status)
 }
 
+// ReplyError converts the error into an HTTP response using the errors registered for the app and
+// writes it back encoded according to the request Accept header.
+func (app *App) ReplyError(w http.ResponseWriter, r *http.Request, err error) {
+	response, status := app.errorResponse(w, err)
+	app.Reply(w, r, response, status)
+}
+
 // ReplyInternalError logs the error message and replies with a 500 status code.
 func ReplyInternalError(w http.ResponseWriter, message string) {
 	LogRequest(nil, 500, time.Nanosecond, errors.New(message))
-	Reply(w, Response{"message": message}, http.StatusInternalServerError)
+	response := Response{"message": message}
+	addRequestID(w, response)
+	Reply(w, response, http.StatusInternalServerError)
 }
 
 // GetVarSafe is a helper function that returns the requested variable from URI with allowSet
@@ -218,8 +452,12 @@ func parseForm(r *http.Request) error {
 
 //Log request
 func logRequest(r *http.Request, status int, elapsedTime time.Duration, err error) {
-	log.Infof("Request(Status=%v, Method=%v, Path=%v, Form=%v, Time=%v, Error=%v)",
-		status, r.Method, r.URL, r.Form, elapsedTime, err)
+	log.Infof("%s", requestLogLine(r, status, elapsedTime, err))
+}
+
+func requestLogLine(r *http.Request, status int, elapsedTime time.Duration, err error) string {
+	return fmt.Sprintf("Request(Status=%v, Method=%v, Path=%v, Route=%v, Form=%v, Time=%v, Error=%v, RequestID=%v)",
+		status, r.Method, r.URL, routeTemplate(r), r.Form, elapsedTime, err, RequestID(r))
 }
 
 // Determine whether the request is multipart/form-data or not.
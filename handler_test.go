@@ -0,0 +1,84 @@
+package scroll
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type HandlerSuite struct{}
+
+var _ = Suite(&HandlerSuite{})
+
+func (s *HandlerSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *HandlerSuite) TestHandlerResult(c *C) {
+	stats := NewPrometheusStats("", nil)
+	var logged bytes.Buffer
+	app, err := NewAppWithConfig(AppConfig{
+		Name:       "test",
+		Stats:      stats,
+		RequestLog: &RequestLogConfig{Fields: []string{LogFieldMethod, LogFieldStatus}, Writer: &logged},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"POST"},
+		Paths:   []string{"/users"},
+		HandlerWithBody: func(w http.ResponseWriter, r *http.Request, params map[string]string, body []byte) (interface{}, error) {
+			return HandlerResult{
+				Status:  http.StatusCreated,
+				Headers: http.Header{"Location": {"/users/1"}, "Etag": {`"v1"`}},
+				Cookies: []*http.Cookie{{Name: "session", Value: "abc"}},
+				Body:    Response{"id": 1},
+			}, nil
+		},
+	}), IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"DELETE"},
+		Paths:   []string{"/users/{id}"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return &HandlerResult{Status: http.StatusNoContent, Body: Response{"deleted": true}}, nil
+		},
+	}), IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/users.geojson"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return HandlerResult{Headers: http.Header{"Content-Type": {"application/geo+json"}}, Body: Response{"type": "Point"}}, nil
+		},
+	}), IsNil)
+
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"bob"}`)))
+	c.Assert(w.Code, Equals, http.StatusCreated)
+	c.Assert(w.Body.String(), Equals, `{"id":1}`)
+	c.Assert(w.Header().Get("Location"), Equals, "/users/1")
+	c.Assert(w.Header().Get("ETag"), Equals, `"v1"`)
+	c.Assert(w.Header().Get("Set-Cookie"), Equals, "session=abc")
+
+	w = httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("DELETE", "/users/1", nil))
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+	c.Assert(w.Body.String(), Equals, "")
+	c.Assert(w.Header().Get("Content-Type"), Equals, "")
+
+	// The content type of the result is kept.
+	w = httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/users.geojson", nil))
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/geo+json")
+	c.Assert(w.Body.String(), Equals, `{"type":"Point"}`)
+
+	// The real status codes are logged and tracked.
+	c.Assert(logged.String(), Equals, "method=POST status=201\nmethod=DELETE status=204\nmethod=GET status=200\n")
+	families := scrapeMetrics(c, stats)
+	c.Assert(findMetric(families, "http_request_duration_seconds", "route", "/users", "method", "POST", "status", "201").
+		GetHistogram().GetSampleCount(), Equals, uint64(1))
+	c.Assert(findMetric(families, "http_request_duration_seconds", "route", "/users/{id}", "method", "DELETE", "status", "204").
+		GetHistogram().GetSampleCount(), Equals, uint64(1))
+}
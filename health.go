@@ -0,0 +1,224 @@
+package scroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of health checks.
+const (
+	// Liveness checks tell whether the app works at all, failing them means that the app should
+	// be restarted. They are served at /_health/live.
+	HealthLiveness = "live"
+
+	// Readiness checks tell whether the app can serve requests, failing them means that no requests
+	// should be sent to the app for the time being. They are served at /_health/ready.
+	HealthReadiness = "ready"
+)
+
+// Statuses of health checks.
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+)
+
+// Names of the readiness checks every app has.
+const (
+	HealthCheckShutdown  = "shutdown"
+	HealthCheckRegistrar = "registrar"
+)
+
+// Defines the signature of a health check function. It should return an error describing the problem
+// if the checked component is not healthy, and give up when the context is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthReport is the outcome of the health checks of a kind, served as JSON at /_health/live and
+// /_health/ready, e.g.:
+//
+//  {"status": "failing", "checks": {"db": {"status": "failing", "error": "dial tcp: connection refused", "duration_ms": 3.1}}}
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// HealthCheckResult is the outcome of a single health check.
+type HealthCheckResult struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+type healthCheck struct {
+	fn      HealthCheckFunc
+	timeout time.Duration
+}
+
+// healthRegistry keeps the health checks of an app by kind and name.
+type healthRegistry struct {
+	mu     sync.RWMutex
+	checks map[string]map[string]healthCheck
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{checks: map[string]map[string]healthCheck{
+		HealthLiveness:  {},
+		HealthReadiness: {},
+	}}
+}
+
+// AddLivenessCheck registers a named liveness check, see HealthLiveness. The check fails if it does
+// not return within the timeout, DefaultHealthCheckTimeout if it is not positive.
+func (app *App) AddLivenessCheck(name string, timeout time.Duration, fn HealthCheckFunc) error {
+	return app.health.add(HealthLiveness, name, timeout, fn)
+}
+
+// AddReadinessCheck registers a named readiness check, see HealthReadiness. The check fails if it does
+// not return within the timeout, DefaultHealthCheckTimeout if it is not positive.
+//
+// Every app has the "shutdown" readiness check failing once the app starts shutting down, and
+// the "registrar" check failing while the app is not registered, e.g. in vulcand, if registration
+// is enabled.
+func (app *App) AddReadinessCheck(name string, timeout time.Duration, fn HealthCheckFunc) error {
+	return app.health.add(HealthReadiness, name, timeout, fn)
+}
+
+// CheckHealth runs all the health checks of the kind concurrently and reports their outcome.
+func (app *App) CheckHealth(ctx context.Context, kind string) (HealthReport, error) {
+	return app.health.run(ctx, kind)
+}
+
+func (h *healthRegistry) add(kind, name string, timeout time.Duration, fn HealthCheckFunc) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("health check must have a name and a function")
+	}
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	checks, ok := h.checks[kind]
+	if !ok {
+		return fmt.Errorf("unknown health check kind: %v", kind)
+	}
+	if _, ok := checks[name]; ok {
+		return fmt.Errorf("%v health check is already registered: %v", kind, name)
+	}
+	checks[name] = healthCheck{fn: fn, timeout: timeout}
+	return nil
+}
+
+func (h *healthRegistry) run(ctx context.Context, kind string) (HealthReport, error) {
+	h.mu.RLock()
+	checks, ok := h.checks[kind]
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]healthCheck, len(names))
+	for i, name := range names {
+		list[i] = checks[name]
+	}
+	h.mu.RUnlock()
+	if !ok {
+		return HealthReport{}, fmt.Errorf("unknown health check kind: %v", kind)
+	}
+
+	results := make([]HealthCheckResult, len(list))
+	var wg sync.WaitGroup
+	for i := range list {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = list[i].run(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthOK, Checks: make(map[string]HealthCheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != HealthOK {
+			report.Status = HealthFailing
+		}
+	}
+	return report, nil
+}
+
+// run calls the check function, giving up on it once the timeout expires. The function is left
+// running in that case, so it should respect the context.
+func (c healthCheck) run(ctx context.Context) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- panicError{p}
+			}
+		}()
+		done <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %v", c.timeout)
+	}
+
+	result := HealthCheckResult{Status: HealthOK, Duration: float64(time.Since(start)) / float64(time.Millisecond)}
+	if err != nil {
+		result.Status, result.Error = HealthFailing, err.Error()
+	}
+	return result
+}
+
+// addBuiltinHealthChecks registers the readiness checks every app has.
+func (app *App) addBuiltinHealthChecks() {
+	app.AddReadinessCheck(HealthCheckShutdown, 0, func(ctx context.Context) error {
+		if app.isShuttingDown() {
+			return errors.New("app is shutting down")
+		}
+		return nil
+	})
+	if app.registrar != nil {
+		app.AddReadinessCheck(HealthCheckRegistrar, 0, func(ctx context.Context) error {
+			return app.registrar.Healthy()
+		})
+	}
+}
+
+func (app *App) isShuttingDown() bool {
+	return atomic.LoadInt32(&app.shuttingDown) == 1
+}
+
+func (app *App) setShuttingDown() {
+	atomic.StoreInt32(&app.shuttingDown, 1)
+}
+
+// healthHandler serves the report of the health checks of the kind, with 200 if they all pass
+// and 503 otherwise.
+func (app *App) healthHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := app.CheckHealth(r.Context(), kind)
+		if err != nil {
+			app.Reply(w, r, Response{"message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		status := http.StatusOK
+		if report.Status != HealthOK {
+			status = http.StatusServiceUnavailable
+		}
+		app.Reply(w, r, report, status)
+	}
+}
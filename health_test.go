@@ -0,0 +1,83 @@
+package scroll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type HealthSuite struct{}
+
+var _ = Suite(&HealthSuite{})
+
+func (s *HealthSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *HealthSuite) TestChecks(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+
+	var dbErr error
+	c.Assert(app.AddReadinessCheck("db", 0, func(ctx context.Context) error { return dbErr }), IsNil)
+	c.Assert(app.AddReadinessCheck("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}), IsNil)
+	c.Assert(app.AddLivenessCheck("loop", 0, func(ctx context.Context) error { return nil }), IsNil)
+	c.Assert(app.AddLivenessCheck("loop", 0, func(ctx context.Context) error { return nil }), ErrorMatches,
+		"live health check is already registered: loop")
+
+	status, report := s.get(c, app, "/_health/live")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(report.Status, Equals, HealthOK)
+	c.Assert(report.Checks, HasLen, 1)
+	c.Assert(report.Checks["loop"].Status, Equals, HealthOK)
+
+	dbErr = errors.New("connection refused")
+	status, report = s.get(c, app, "/_health/ready")
+	c.Assert(status, Equals, http.StatusServiceUnavailable)
+	c.Assert(report.Status, Equals, HealthFailing)
+	c.Assert(report.Checks, HasLen, 4)
+	c.Assert(report.Checks["db"], DeepEquals, HealthCheckResult{Status: HealthFailing, Error: "connection refused",
+		Duration: report.Checks["db"].Duration})
+	c.Assert(report.Checks["slow"].Status, Equals, HealthFailing)
+	c.Assert(report.Checks["slow"].Error, Equals, "timed out after 10ms")
+	c.Assert(report.Checks[HealthCheckShutdown].Status, Equals, HealthOK)
+
+	// The app is not registered in vulcand until it runs.
+	c.Assert(report.Checks[HealthCheckRegistrar].Error, Equals, "vulcand registration is not running")
+}
+
+func (s *HealthSuite) TestShutdown(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+
+	_, report := s.get(c, app, "/_health/ready")
+	c.Assert(report.Checks[HealthCheckShutdown].Status, Equals, HealthOK)
+
+	app.setShuttingDown()
+
+	status, report := s.get(c, app, "/_health/ready")
+	c.Assert(status, Equals, http.StatusServiceUnavailable)
+	c.Assert(report.Checks[HealthCheckShutdown], DeepEquals, HealthCheckResult{Status: HealthFailing,
+		Error: "app is shutting down", Duration: report.Checks[HealthCheckShutdown].Duration})
+
+	// The app is still alive while shutting down.
+	status, _ = s.get(c, app, "/_health/live")
+	c.Assert(status, Equals, http.StatusOK)
+}
+
+func (s *HealthSuite) get(c *C, app *App, path string) (int, HealthReport) {
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var report HealthReport
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &report), IsNil)
+	return w.Code, report
+}
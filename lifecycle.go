@@ -0,0 +1,80 @@
+package scroll
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mailgun/log"
+)
+
+// Defines the signature of a function called when the app starts or shuts down.
+type Hook func(ctx context.Context) error
+
+// OnStart registers a hook called by Run and RunContext before the app starts serving requests, e.g.
+// to start background workers. The hooks are called in the order they were registered with the context
+// of RunContext. If a hook fails, the rest of them are not called and the app does not start; the
+// shutdown hooks are called nevertheless, so they should cope with the app not being fully started.
+func (app *App) OnStart(hook Hook) {
+	app.startHooks = append(app.startHooks, hook)
+}
+
+// OnShutdown registers a hook called by Run and RunContext once the HTTP server has stopped, e.g. to
+// flush queues. The hooks are called in the reverse order they were registered, so that components
+// shut down before the components they depend on. They are all called even if some fail, and share
+// the shutdown timeout of the app.
+func (app *App) OnShutdown(hook Hook) {
+	app.shutdownHooks = append(app.shutdownHooks, hook)
+}
+
+func (app *App) runStartHooks(ctx context.Context) error {
+	for i, hook := range app.startHooks {
+		if err := hook(ctx); err != nil {
+			return fmt.Errorf("start hook #%d failed: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (app *App) runShutdownHooks() []error {
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.Shutdown.Timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(app.shutdownHooks) - 1; i >= 0; i-- {
+		if err := app.shutdownHooks[i](ctx); err != nil {
+			log.Errorf("Shutdown hook #%d failed: err=%v", i, err)
+			errs = append(errs, fmt.Errorf("shutdown hook #%d failed: %v", i, err))
+		}
+	}
+	return errs
+}
+
+// MultiError is returned when several things went wrong, e.g. when several shutdown hooks failed.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// joinErrors returns nil if there are no errors other than nil, the error if there is only one,
+// and `MultiError` otherwise.
+func joinErrors(errs []error) error {
+	var result MultiError
+	for _, err := range errs {
+		if err != nil {
+			result = append(result, err)
+		}
+	}
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package scroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type LifecycleSuite struct{}
+
+var _ = Suite(&LifecycleSuite{})
+
+func (s *LifecycleSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *LifecycleSuite) TestRunContext(c *C) {
+	app := s.newApp(c)
+
+	var calls []string
+	ctx, cancel := context.WithCancel(context.Background())
+	app.OnStart(func(context.Context) error {
+		calls = append(calls, "start worker")
+		return nil
+	})
+	app.OnStart(func(context.Context) error {
+		calls = append(calls, "start server")
+		// The app is not serving requests yet.
+		_, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/_ping", app.Config.ListenPort))
+		c.Check(err, NotNil)
+		go func() {
+			s.waitServing(app)
+			cancel()
+		}()
+		return nil
+	})
+	app.OnShutdown(func(context.Context) error {
+		calls = append(calls, "stop worker")
+		return errors.New("queue not flushed")
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		calls = append(calls, "stop server")
+		c.Check(ctx.Err(), IsNil)
+		return errors.New("connections not closed")
+	})
+
+	err := app.RunContext(ctx)
+	c.Assert(err, DeepEquals, MultiError{
+		errors.New("shutdown hook #1 failed: connections not closed"),
+		errors.New("shutdown hook #0 failed: queue not flushed"),
+	})
+	c.Assert(calls, DeepEquals, []string{"start worker", "start server", "stop server", "stop worker"})
+}
+
+func (s *LifecycleSuite) TestRunContextCleanShutdown(c *C) {
+	app := s.newApp(c)
+	go func() {
+		s.waitServing(app)
+		app.Stop()
+	}()
+	c.Assert(app.RunContext(context.Background()), Equals, http.ErrServerClosed)
+}
+
+func (s *LifecycleSuite) TestStartHookFailure(c *C) {
+	app := s.newApp(c)
+
+	var calls []string
+	app.OnStart(func(context.Context) error { return errors.New("no database") })
+	app.OnStart(func(context.Context) error {
+		calls = append(calls, "start")
+		return nil
+	})
+	app.OnShutdown(func(context.Context) error {
+		calls = append(calls, "stop")
+		return nil
+	})
+
+	c.Assert(app.RunContext(context.Background()), ErrorMatches, "start hook #0 failed: no database")
+	c.Assert(calls, DeepEquals, []string{"stop"})
+}
+
+// newApp creates an app listening on a free local port, without vulcand registration.
+func (s *LifecycleSuite) newApp(c *C) *App {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	port := l.Addr().(*net.TCPAddr).Port
+	c.Assert(l.Close(), IsNil)
+
+	app, err := NewAppWithConfig(AppConfig{Name: "test", ListenIP: "127.0.0.1", ListenPort: port})
+	c.Assert(err, IsNil)
+	app.registrar = nil
+	return app
+}
+
+func (s *LifecycleSuite) waitServing(app *App) {
+	for {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/_ping", app.Config.ListenPort))
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,282 @@
+package scroll
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailgun/log"
+)
+
+// Fields of the request log lines that can be selected with RequestLogConfig.Fields.
+const (
+	LogFieldMethod    = "method"
+	LogFieldPath      = "path"
+	LogFieldRoute     = "route"
+	LogFieldMetric    = "metric"
+	LogFieldStatus    = "status"
+	LogFieldBytes     = "bytes"
+	LogFieldRemoteIP  = "remote_ip"
+	LogFieldUserAgent = "user_agent"
+	LogFieldRequestID = "request_id"
+	LogFieldLatency   = "latency_ms"
+	LogFieldError     = "error"
+	LogFieldForm      = "form"
+	LogFieldHeaders   = "headers"
+)
+
+// Fields logged unless RequestLogConfig.Fields is provided. The form and headers are not logged
+// by default, because even redacted they tend to make log lines large.
+var DefaultLogFields = []string{
+	LogFieldMethod, LogFieldPath, LogFieldRoute, LogFieldMetric, LogFieldStatus, LogFieldBytes, LogFieldRemoteIP,
+	LogFieldUserAgent, LogFieldRequestID, LogFieldLatency, LogFieldError,
+}
+
+// Value that redacted form fields and headers are logged with.
+const redacted = "REDACTED"
+
+// Headers and form fields that are always redacted, because they carry credentials.
+var (
+	alwaysRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+	alwaysRedactedFields  = []string{"password", "api_key", "secret", "token"}
+)
+
+// RequestLogFormat defines how request log lines are formatted.
+type RequestLogFormat int
+
+const (
+	// RequestLogKeyValue formats log lines as space separated key=value pairs, with values quoted
+	// if needed, e.g.:
+	//
+	//  method=GET path=/v3/users status=200 user_agent="curl/7.58.0"
+	RequestLogKeyValue RequestLogFormat = iota
+
+	// RequestLogJSON formats log lines as JSON objects.
+	RequestLogJSON
+)
+
+// RequestLogConfig configures the structured logging of the requests served by an app's handlers.
+type RequestLogConfig struct {
+	// format of the log lines, RequestLogKeyValue if not specified
+	Format RequestLogFormat
+
+	// fields to log in the order they should appear in, DefaultLogFields if not specified
+	Fields []string
+
+	// names of the form fields and headers to log redacted for all handlers, in addition to those
+	// of the handler spec; the Authorization, Proxy-Authorization and Cookie headers and the password,
+	// api_key, secret and token form fields are always redacted
+	RedactFields  []string
+	RedactHeaders []string
+
+	// log only one of every SampleSuccessful successful requests; failed requests are always logged,
+	// and so are all requests if it is not specified
+	SampleSuccessful int
+
+	// where to write the log lines, github.com/mailgun/log.Infof if not specified
+	Writer io.Writer
+}
+
+// requestLogger writes structured request log lines according to the app config.
+type requestLogger struct {
+	config    RequestLogConfig
+	successes uint64
+}
+
+func newRequestLogger(config RequestLogConfig) (*requestLogger, error) {
+	if len(config.Fields) == 0 {
+		config.Fields = DefaultLogFields
+	}
+	config.RedactHeaders = append(config.RedactHeaders[:len(config.RedactHeaders):len(config.RedactHeaders)],
+		alwaysRedactedHeaders...)
+	config.RedactFields = append(config.RedactFields[:len(config.RedactFields):len(config.RedactFields)],
+		alwaysRedactedFields...)
+
+	// Check the fields against a blank request, as the values do not matter.
+	l := &requestLogger{config: config}
+	for _, field := range config.Fields {
+		if _, ok := l.fieldValue(field, Spec{}, &http.Request{URL: &url.URL{}}, 0, 0, 0, nil); !ok {
+			return nil, fmt.Errorf("unknown request log field: %v", field)
+		}
+	}
+	return l, nil
+}
+
+// logRequest logs the request served by a handler made for the spec. It uses the structured request
+// logger if the app has one configured, and the LogRequest function otherwise. LogRequest is given
+// a copy of the request with the form fields and query parameters redacted.
+func (app *App) logRequest(spec Spec, r *http.Request, w *responseWriter, status int, elapsedTime time.Duration, err error) {
+	if app.requestLogger == nil {
+		LogRequest(redactRequest(r, spec), status, elapsedTime, err)
+		return
+	}
+	app.requestLogger.log(spec, r, status, w.bytes, elapsedTime, err)
+}
+
+// redactRequest returns a shallow copy of the request with the values of the form fields and query
+// parameters that are always redacted or redacted by the spec replaced.
+func redactRequest(r *http.Request, spec Spec) *http.Request {
+	redactedReq := *r
+	redactedReq.Form = redactValues(r.Form, alwaysRedactedFields, spec.RedactFields)
+	redactedReq.PostForm = redactValues(r.PostForm, alwaysRedactedFields, spec.RedactFields)
+	redactedReq.MultipartForm = nil
+	if r.URL != nil && r.URL.RawQuery != "" {
+		u := *r.URL
+		u.RawQuery = redactValues(r.URL.Query(), alwaysRedactedFields, spec.RedactFields).Encode()
+		redactedReq.URL = &u
+	}
+	return &redactedReq
+}
+
+func (l *requestLogger) log(spec Spec, r *http.Request, status int, written int64, elapsedTime time.Duration, err error) {
+	if status < http.StatusBadRequest && l.config.SampleSuccessful > 1 {
+		if n := atomic.AddUint64(&l.successes, 1); n%uint64(l.config.SampleSuccessful) != 1 {
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if l.config.Format == RequestLogJSON {
+		buf.WriteByte('{')
+	}
+	for i, field := range l.config.Fields {
+		value, _ := l.fieldValue(field, spec, r, status, written, elapsedTime, err)
+		if l.config.Format == RequestLogJSON {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONField(&buf, field, value)
+		} else {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeKeyValue(&buf, field, value)
+		}
+	}
+	if l.config.Format == RequestLogJSON {
+		buf.WriteByte('}')
+	}
+
+	if l.config.Writer == nil {
+		log.Infof("%s", buf.String())
+		return
+	}
+	buf.WriteByte('\n')
+	l.config.Writer.Write(buf.Bytes())
+}
+
+// fieldValue returns the value of the log field, or false if the field is unknown.
+func (l *requestLogger) fieldValue(field string, spec Spec, r *http.Request, status int, written int64,
+	elapsedTime time.Duration, err error) (interface{}, bool) {
+
+	switch field {
+	case LogFieldMethod:
+		return r.Method, true
+	case LogFieldPath:
+		return r.URL.Path, true
+	case LogFieldRoute:
+		return routeTemplate(r), true
+	case LogFieldMetric:
+		return metricID(spec, r), true
+	case LogFieldStatus:
+		return status, true
+	case LogFieldBytes:
+		return written, true
+	case LogFieldRemoteIP:
+		return remoteIP(r), true
+	case LogFieldUserAgent:
+		return r.UserAgent(), true
+	case LogFieldRequestID:
+		return RequestID(r), true
+	case LogFieldLatency:
+		return float64(elapsedTime) / float64(time.Millisecond), true
+	case LogFieldError:
+		if err == nil {
+			return "", true
+		}
+		return err.Error(), true
+	case LogFieldForm:
+		return redactValues(r.Form, l.config.RedactFields, spec.RedactFields), true
+	case LogFieldHeaders:
+		return redactValues(url.Values(r.Header), l.config.RedactHeaders, spec.RedactHeaders), true
+	}
+	return nil, false
+}
+
+// redactValues returns a copy of the values with the values of the listed keys replaced. Keys are
+// matched case-insensitively, as clients spell form fields and headers their own way.
+func redactValues(values url.Values, common, specific []string) url.Values {
+	result := make(url.Values, len(values))
+	for k, v := range values {
+		result[k] = v
+		if !containsFold(common, k) && !containsFold(specific, k) {
+			continue
+		}
+		result[k] = make([]string, len(v))
+		for i := range v {
+			result[k][i] = redacted
+		}
+	}
+	return result
+}
+
+// containsFold reports whether the key is in the list, ignoring case.
+func containsFold(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the client, which is the first address in X-Forwarded-For
+// if the request was proxied, e.g. by vulcand.
+func remoteIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.WriteString(strconv.Quote(key))
+	buf.WriteByte(':')
+	buf.Write(data)
+}
+
+func writeKeyValue(buf *bytes.Buffer, key string, value interface{}) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', 3, 64)
+	case url.Values:
+		s = v.Encode()
+	default:
+		s = fmt.Sprint(v)
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
@@ -0,0 +1,156 @@
+package scroll
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type LoggingSuite struct{}
+
+var _ = Suite(&LoggingSuite{})
+
+func (s *LoggingSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *LoggingSuite) serve(c *C, config RequestLogConfig, spec Spec, r *http.Request) string {
+	var buf bytes.Buffer
+	config.Writer = &buf
+	app, err := NewAppWithConfig(AppConfig{Name: "test", RequestLog: &config})
+	c.Assert(err, IsNil)
+
+	spec.Methods = []string{"GET", "POST"}
+	spec.Paths = []string{"/v3/{domain}/events"}
+	c.Assert(app.AddHandler(spec), IsNil)
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), r)
+	return buf.String()
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+	return Response{"message": "OK"}, nil
+}
+
+func (s *LoggingSuite) TestKeyValue(c *C) {
+	r := httptest.NewRequest("GET", "/v3/example.com/events", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	r.Header.Set("User-Agent", "curl/7.58.0 (x86_64)")
+	r.Header.Set(RequestIDHeader, "abc")
+
+	line := s.serve(c, RequestLogConfig{}, Spec{Handler: okHandler}, r)
+	c.Assert(line, Matches, `method=GET path=/v3/example.com/events route=/v3/\{domain\}/events metric=get_v3_domain_events status=200 bytes=16 `+
+		`remote_ip=10.0.0.1 user_agent="curl/7.58.0 \(x86_64\)" request_id=abc latency_ms=\d+\.\d{3} error=""\n`)
+}
+
+func (s *LoggingSuite) TestJSONWithRedaction(c *C) {
+	r := httptest.NewRequest("POST", "/v3/example.com/events", strings.NewReader("user=bob&password=secret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Basic Ym9iOnNlY3JldA==")
+	r.Header.Set("X-Api-Key", "key-123")
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.1")
+
+	config := RequestLogConfig{
+		Format: RequestLogJSON,
+		Fields: []string{LogFieldStatus, LogFieldRemoteIP, LogFieldForm, LogFieldHeaders, LogFieldError},
+	}
+	spec := Spec{
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return nil, NotFoundError{"no such user"}
+		},
+		RedactFields:  []string{"password"},
+		RedactHeaders: []string{"x-api-key"},
+	}
+	line := s.serve(c, config, spec, r)
+	c.Assert(line, Equals, `{"status":404,"remote_ip":"1.2.3.4","form":{"password":["REDACTED"],"user":["bob"]},`+
+		`"headers":{"Authorization":["REDACTED"],"Content-Type":["application/x-www-form-urlencoded"],`+
+		`"X-Api-Key":["REDACTED"],"X-Forwarded-For":["1.2.3.4, 10.0.0.1"]},"error":"no such user"}`+"\n")
+}
+
+func (s *LoggingSuite) TestDefaultLogRedaction(c *C) {
+	var lines []string
+	defer func(logRequest func(*http.Request, int, time.Duration, error)) { LogRequest = logRequest }(LogRequest)
+	LogRequest = func(r *http.Request, status int, elapsedTime time.Duration, err error) {
+		lines = append(lines, requestLogLine(r, status, elapsedTime, err))
+	}
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods:      []string{"POST"},
+		Paths:        []string{"/users"},
+		Handler:      okHandler,
+		RedactFields: []string{"ssn"},
+	}), IsNil)
+
+	r := httptest.NewRequest("POST", "/users?password=hunter2&page=2", strings.NewReader("user=bob&password=hunter2&ssn=123-45"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), r)
+
+	c.Assert(lines, HasLen, 1)
+	c.Assert(strings.Contains(lines[0], "hunter2"), Equals, false, Commentf(lines[0]))
+	c.Assert(strings.Contains(lines[0], "123-45"), Equals, false, Commentf(lines[0]))
+	c.Assert(lines[0], Matches, `Request\(Status=200, Method=POST, Path=/users\?page=2&password=REDACTED, Route=/users, `+
+		`Form=map\[page:\[2\] password:\[REDACTED REDACTED\] ssn:\[REDACTED\] user:\[bob\]\], .*`)
+}
+
+// Fields are redacted whatever the case they are sent in.
+func (s *LoggingSuite) TestRedactionIgnoresCase(c *C) {
+	var lines []string
+	defer func(logRequest func(*http.Request, int, time.Duration, error)) { LogRequest = logRequest }(LogRequest)
+	LogRequest = func(r *http.Request, status int, elapsedTime time.Duration, err error) {
+		lines = append(lines, requestLogLine(r, status, elapsedTime, err))
+	}
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods:      []string{"POST"},
+		Paths:        []string{"/users"},
+		Handler:      okHandler,
+		RedactFields: []string{"ssn"},
+	}), IsNil)
+
+	r := httptest.NewRequest("POST", "/users?Password=hunter2&API_KEY=key-1", strings.NewReader("user=bob&SSN=123-45&Token=abc"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), r)
+
+	c.Assert(lines, HasLen, 1)
+	for _, secret := range []string{"hunter2", "key-1", "123-45", "abc"} {
+		c.Assert(strings.Contains(lines[0], secret), Equals, false, Commentf(lines[0]))
+	}
+	c.Assert(lines[0], Matches, `Request\(Status=200, Method=POST, Path=/users\?API_KEY=REDACTED&Password=REDACTED, Route=/users, .*`)
+
+	config := RequestLogConfig{Fields: []string{LogFieldForm}, RedactFields: []string{"token"}}
+	line := s.serve(c, config, Spec{Handler: okHandler, RedactFields: []string{"ssn"}},
+		httptest.NewRequest("GET", "/v3/example.com/events?Token=abc&SSN=123-45&user=bob", nil))
+	c.Assert(line, Equals, `form="SSN=REDACTED&Token=REDACTED&user=bob"`+"\n")
+}
+
+func (s *LoggingSuite) TestSampling(c *C) {
+	var buf bytes.Buffer
+	config := RequestLogConfig{Fields: []string{LogFieldStatus}, SampleSuccessful: 3, Writer: &buf}
+	app, err := NewAppWithConfig(AppConfig{Name: "test", RequestLog: &config})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{Methods: []string{"GET"}, Paths: []string{"/ok"}, Handler: okHandler}), IsNil)
+	c.Assert(app.AddHandler(Spec{Methods: []string{"GET"}, Paths: []string{"/missing"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return nil, NotFoundError{"no such user"}
+		}}), IsNil)
+
+	for i := 0; i < 7; i++ {
+		app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	}
+	// Failed requests are always logged.
+	for i := 0; i < 2; i++ {
+		app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	}
+	c.Assert(buf.String(), Equals, "status=200\nstatus=200\nstatus=200\nstatus=404\nstatus=404\n")
+}
+
+func (s *LoggingSuite) TestUnknownField(c *C) {
+	_, err := NewAppWithConfig(AppConfig{Name: "test", RequestLog: &RequestLogConfig{Fields: []string{"password"}}})
+	c.Assert(err, ErrorMatches, "unknown request log field: password")
+}
@@ -0,0 +1,40 @@
+package scroll
+
+import "net/http"
+
+// HandlerMiddleware wraps a handler to run code in-process before and after it, e.g. to authenticate
+// requests. Unlike Spec.Middlewares, which are executed by vulcand, handler middlewares are executed
+// by the app itself, so they work regardless of how requests reach it.
+//
+// A middleware can stop the request from reaching the handler by replying without calling the
+// wrapped handler, e.g.:
+//
+//  func requireToken(next http.Handler) http.Handler {
+//      return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//          if r.Header.Get("X-Token") == "" {
+//              scroll.ReplyError(w, scroll.GenericAPIError{"Missing token"})
+//              return
+//          }
+//          next.ServeHTTP(w, r)
+//      })
+//  }
+type HandlerMiddleware func(http.Handler) http.Handler
+
+// Use adds middlewares that wrap every handler registered with AddHandler afterwards, so it should be
+// called before adding the handlers. Middlewares are executed in the order they are added, and before
+// the middlewares of the handler spec.
+func (app *App) Use(middlewares ...HandlerMiddleware) {
+	app.middlewares = append(app.middlewares, middlewares...)
+}
+
+// wrapHandler wraps the handler made for the spec with the app middlewares and the spec middlewares,
+// so that the first middleware in the chain is the outermost one.
+func (app *App) wrapHandler(spec Spec, handler http.Handler) http.Handler {
+	middlewares := make([]HandlerMiddleware, 0, len(app.middlewares)+len(spec.HandlerMiddlewares))
+	middlewares = append(middlewares, app.middlewares...)
+	middlewares = append(middlewares, spec.HandlerMiddlewares...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,80 @@
+package scroll
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type MiddlewareSuite struct{}
+
+var _ = Suite(&MiddlewareSuite{})
+
+func (s *MiddlewareSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+// tagMiddleware makes a middleware that appends the tag to the X-Trace response header.
+func tagMiddleware(tag string) HandlerMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", tag)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *MiddlewareSuite) TestOrder(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	app.Use(tagMiddleware("app1"), tagMiddleware("app2"))
+
+	for i, spec := range []Spec{{
+		Paths:              []string{"/handler"},
+		Handler:            func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) { return Response{}, nil },
+		HandlerMiddlewares: []HandlerMiddleware{tagMiddleware("spec")},
+	}, {
+		Paths:              []string{"/body"},
+		HandlerWithBody:    func(w http.ResponseWriter, r *http.Request, params map[string]string, body []byte) (interface{}, error) { return Response{}, nil },
+		HandlerMiddlewares: []HandlerMiddleware{tagMiddleware("spec")},
+	}, {
+		Paths:              []string{"/raw"},
+		RawHandler:         func(w http.ResponseWriter, r *http.Request) { w.Header().Add("X-Trace", "handler") },
+		HandlerMiddlewares: []HandlerMiddleware{tagMiddleware("spec")},
+	}} {
+		c.Logf("Test case #%d", i)
+		spec.Methods = []string{"GET"}
+		c.Assert(app.AddHandler(spec), IsNil)
+
+		w := httptest.NewRecorder()
+		app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", spec.Paths[0], nil))
+		c.Assert(strings.Join(w.Header()["X-Trace"], ","), Matches, "app1,app2,spec(,handler)?")
+	}
+}
+
+func (s *MiddlewareSuite) TestShortCircuit(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ReplyError(w, GenericAPIError{"Missing token"})
+		})
+	})
+	called := false
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/secret"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			called = true
+			return Response{}, nil
+		},
+	}), IsNil)
+
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/secret", nil))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(called, Equals, false)
+}
@@ -0,0 +1,187 @@
+package scroll
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Page describes the part of a result set requested by a client with the `limit`, `skip`
+// and `cursor` fields.
+type Page struct {
+	// Number of items to return, between 1 and MaxLimit, DefaultLimit if not requested.
+	Limit int
+
+	// Number of items to skip for offset based paging.
+	Skip int
+
+	// Opaque cursor for cursor based paging, decode it with App.DecodeCursor.
+	Cursor string
+}
+
+// PagingLinks are the URLs of the pages around the returned one. Links to the pages that do not
+// exist or can not be determined are empty.
+type PagingLinks struct {
+	First    string `json:"first,omitempty"`
+	Next     string `json:"next,omitempty"`
+	Previous string `json:"previous,omitempty"`
+	Last     string `json:"last,omitempty"`
+}
+
+// ParsePage retrieves the requested page from the request fields. Returns `ValidationErrors`
+// if the limit is out of the 1..MaxLimit range or skip is negative.
+func ParsePage(r *http.Request) (Page, error) {
+	v := NewFieldValidator(r)
+	page := Page{
+		Limit:  v.IntWithDefault("limit", DefaultLimit),
+		Skip:   v.IntWithDefault("skip", 0),
+		Cursor: GetStringFieldWithDefault(r, "cursor", ""),
+	}
+	if err := v.Err(); err != nil {
+		return page, err
+	}
+	if page.Limit < 1 || page.Limit > MaxLimit {
+		v.Check(InvalidParameterError{"limit", fmt.Sprintf("must be between 1 and %d", MaxLimit)})
+	}
+	if page.Skip < 0 {
+		v.Check(InvalidParameterError{"skip", "must not be negative"})
+	}
+	return page, v.Err()
+}
+
+// OffsetPage makes a response with the items of the page and links to the pages around it, e.g.:
+//
+//  {"items": [...], "paging": {"first": "...?limit=10&skip=0", "next": "...?limit=10&skip=20", ...}}
+//
+// Total is the number of items in the whole result set, or a negative number if it is unknown.
+// If the total is unknown, there is no link to the last page and the next page is assumed to exist
+// if the page is full.
+func (app *App) OffsetPage(r *http.Request, page Page, items interface{}, total int) Response {
+	if page.Limit <= 0 {
+		page.Limit = DefaultLimit
+	}
+	links := PagingLinks{First: app.pageURL(r, page.Limit, "skip", "0")}
+	if page.Skip > 0 {
+		previous := page.Skip - page.Limit
+		if previous < 0 {
+			previous = 0
+		}
+		links.Previous = app.pageURL(r, page.Limit, "skip", strconv.Itoa(previous))
+	}
+	next := page.Skip + page.Limit
+	if total >= 0 {
+		if next < total {
+			links.Next = app.pageURL(r, page.Limit, "skip", strconv.Itoa(next))
+		}
+		last := 0
+		if total > 0 {
+			last = (total - 1) / page.Limit * page.Limit
+		}
+		links.Last = app.pageURL(r, page.Limit, "skip", strconv.Itoa(last))
+	} else if count(items) >= page.Limit {
+		links.Next = app.pageURL(r, page.Limit, "skip", strconv.Itoa(next))
+	}
+	return Response{"items": items, "paging": links}
+}
+
+// CursorPage makes a response with the items of the page and links to the pages around it, just like
+// OffsetPage. The cursors of the next and previous pages should be made with App.EncodeCursor,
+// empty cursors mean that there are no such pages.
+func (app *App) CursorPage(r *http.Request, page Page, items interface{}, next, previous string) Response {
+	if page.Limit <= 0 {
+		page.Limit = DefaultLimit
+	}
+	links := PagingLinks{First: app.pageURL(r, page.Limit, "cursor", "")}
+	if next != "" {
+		links.Next = app.pageURL(r, page.Limit, "cursor", next)
+	}
+	if previous != "" {
+		links.Previous = app.pageURL(r, page.Limit, "cursor", previous)
+	}
+	return Response{"items": items, "paging": links}
+}
+
+// EncodeCursor makes an opaque cursor out of the JSON-marshallable value, e.g. the sort key of the
+// last returned item. The cursor is signed with AppConfig.CursorKey, so clients can not forge it.
+// Returns an error if the app has no cursor key configured.
+func (app *App) EncodeCursor(v interface{}) (string, error) {
+	if len(app.Config.CursorKey) == 0 {
+		return "", errNoCursorKey
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cursor: %v", err)
+	}
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(app.signCursor(payload)), nil
+}
+
+// DecodeCursor unmarshals the value encoded into the cursor with EncodeCursor. Returns
+// `InvalidParameterError` if the cursor is malformed or was not made by the app, and an error if
+// the app has no cursor key configured.
+func (app *App) DecodeCursor(cursor string, v interface{}) error {
+	if len(app.Config.CursorKey) == 0 {
+		return errNoCursorKey
+	}
+	invalid := InvalidParameterError{"cursor", cursor}
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return invalid
+	}
+	encoding := base64.RawURLEncoding
+	payload, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return invalid
+	}
+	signature, err := encoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, app.signCursor(payload)) {
+		return invalid
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return invalid
+	}
+	return nil
+}
+
+var errNoCursorKey = errors.New("AppConfig.CursorKey is required to use paging cursors")
+
+func (app *App) signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, app.Config.CursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// pageURL makes the URL of another page of the requested resource: the request URL with the limit
+// and the paging field set to the value, or removed if the value is empty. The URL is absolute if the
+// API URL of the request scope is configured.
+func (app *App) pageURL(r *http.Request, limit int, field, value string) string {
+	query := r.URL.Query()
+	query.Del("skip")
+	query.Del("cursor")
+	query.Set("limit", strconv.Itoa(limit))
+	if value != "" {
+		query.Set(field, value)
+	}
+
+	base := app.Config.ProtectedAPIURL
+	if app.IsPublicRequest(r) {
+		base = app.Config.PublicAPIURL
+	}
+	return strings.TrimSuffix(base, "/") + r.URL.EscapedPath() + "?" + query.Encode()
+}
+
+// count returns the number of items in a slice, or zero if items is not a slice.
+func count(items interface{}) int {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0
+	}
+	return v.Len()
+}
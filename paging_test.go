@@ -0,0 +1,115 @@
+package scroll
+
+import (
+	"net/http/httptest"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type PagingSuite struct {
+	app *App
+}
+
+var _ = Suite(&PagingSuite{})
+
+func (s *PagingSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{
+		Name:             "test",
+		CursorKey:        []byte("cursor key"),
+		PublicAPIHost:    "api.example.com",
+		PublicAPIURL:     "https://api.example.com/",
+		ProtectedAPIHost: "localhost",
+		ProtectedAPIURL:  "http://localhost:8080",
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *PagingSuite) TestParsePage(c *C) {
+	r := httptest.NewRequest("GET", "/v3/events", nil)
+	c.Assert(parseForm(r), IsNil)
+	page, err := ParsePage(r)
+	c.Assert(err, IsNil)
+	c.Assert(page, Equals, Page{Limit: DefaultLimit})
+
+	r = httptest.NewRequest("GET", "/v3/events?limit=10&skip=20&cursor=abc", nil)
+	c.Assert(parseForm(r), IsNil)
+	page, err = ParsePage(r)
+	c.Assert(err, IsNil)
+	c.Assert(page, Equals, Page{Limit: 10, Skip: 20, Cursor: "abc"})
+
+	r = httptest.NewRequest("GET", "/v3/events?limit=20000&skip=-1", nil)
+	c.Assert(parseForm(r), IsNil)
+	_, err = ParsePage(r)
+	c.Assert(err, DeepEquals, ValidationErrors{
+		InvalidParameterError{"limit", "must be between 1 and 10000"},
+		InvalidParameterError{"skip", "must not be negative"},
+	})
+
+	r = httptest.NewRequest("GET", "/v3/events?limit=ten", nil)
+	c.Assert(parseForm(r), IsNil)
+	_, err = ParsePage(r)
+	c.Assert(err, DeepEquals, ValidationErrors{InvalidFormatError{"limit", "ten"}})
+}
+
+func (s *PagingSuite) TestOffsetPage(c *C) {
+	r := httptest.NewRequest("GET", "http://api.example.com/v3/example.com/events?limit=10&skip=20&event=failed", nil)
+	items := []int{1, 2, 3}
+
+	response := s.app.OffsetPage(r, Page{Limit: 10, Skip: 20}, items, 45)
+	c.Assert(response["items"], DeepEquals, items)
+	c.Assert(response["paging"], Equals, PagingLinks{
+		First:    "https://api.example.com/v3/example.com/events?event=failed&limit=10&skip=0",
+		Next:     "https://api.example.com/v3/example.com/events?event=failed&limit=10&skip=30",
+		Previous: "https://api.example.com/v3/example.com/events?event=failed&limit=10&skip=10",
+		Last:     "https://api.example.com/v3/example.com/events?event=failed&limit=10&skip=40",
+	})
+
+	// Unknown total, the page is not full.
+	r = httptest.NewRequest("GET", "http://localhost/v3/events?limit=10&skip=5", nil)
+	response = s.app.OffsetPage(r, Page{Limit: 10, Skip: 5}, items, -1)
+	c.Assert(response["paging"], Equals, PagingLinks{
+		First:    "http://localhost:8080/v3/events?limit=10&skip=0",
+		Previous: "http://localhost:8080/v3/events?limit=10&skip=0",
+	})
+}
+
+func (s *PagingSuite) TestCursorPage(c *C) {
+	type position struct {
+		ID   string `json:"id"`
+		Time int64  `json:"t"`
+	}
+	next, err := s.app.EncodeCursor(position{"abc", 1500000000})
+	c.Assert(err, IsNil)
+
+	r := httptest.NewRequest("GET", "http://api.example.com/v3/events?cursor=xyz", nil)
+	response := s.app.CursorPage(r, Page{Limit: 10, Cursor: "xyz"}, []int{1}, next, "")
+	c.Assert(response["paging"], Equals, PagingLinks{
+		First: "https://api.example.com/v3/events?limit=10",
+		Next:  "https://api.example.com/v3/events?cursor=" + next + "&limit=10",
+	})
+
+	var decoded position
+	c.Assert(s.app.DecodeCursor(next, &decoded), IsNil)
+	c.Assert(decoded, Equals, position{"abc", 1500000000})
+
+	// Other instances of the app accept the cursor, but cursors signed with a different key are rejected.
+	instance, err := NewAppWithConfig(AppConfig{Name: "test", CursorKey: []byte("cursor key")})
+	c.Assert(err, IsNil)
+	c.Assert(instance.DecodeCursor(next, &decoded), IsNil)
+	other, err := NewAppWithConfig(AppConfig{Name: "test", CursorKey: []byte("other key")})
+	c.Assert(err, IsNil)
+	c.Assert(other.DecodeCursor(next, &decoded), Equals, InvalidParameterError{"cursor", next})
+	c.Assert(s.app.DecodeCursor("garbage", &decoded), Equals, InvalidParameterError{"cursor", "garbage"})
+}
+
+func (s *PagingSuite) TestNoCursorKey(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	_, err = app.EncodeCursor("abc")
+	c.Assert(err, ErrorMatches, "AppConfig.CursorKey is required to use paging cursors")
+	var decoded string
+	c.Assert(app.DecodeCursor("abc.def", &decoded), ErrorMatches, "AppConfig.CursorKey is required to use paging cursors")
+}
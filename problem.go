@@ -0,0 +1,112 @@
+package scroll
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ErrorFormat defines how an app renders error responses.
+type ErrorFormat int
+
+const (
+	// ErrorFormatMessage renders errors as {"message": "..."} objects.
+	ErrorFormatMessage ErrorFormat = iota
+
+	// ErrorFormatProblem renders errors as RFC 7807 application/problem+json documents.
+	ErrorFormatProblem
+)
+
+// Problem is an RFC 7807 problem details document. Replies made with a Problem response are always
+// JSON encoded with the application/problem+json content type.
+type Problem map[string]interface{}
+
+// problemEncoder encodes Problem responses.
+type problemEncoder struct {
+	JSONEncoder
+}
+
+func (e problemEncoder) ContentType() string {
+	return "application/problem+json"
+}
+
+// errorResponse converts the error into a response and status code using the errors registered for
+// the app and in the format configured for the app. Headers supplied by the error are set on
+// the response writer, and the ID of the request is added to the response.
+func (app *App) errorResponse(w http.ResponseWriter, err error) (interface{}, int) {
+	response, status, header := app.errorBody(err)
+	setHeaders(w, header)
+	addRequestID(w, response)
+	return response, status
+}
+
+// errorBody is like errorResponse, but returns the headers supplied by the error instead of setting them.
+func (app *App) errorBody(err error) (interface{}, int, http.Header) {
+	response, status, header, matched := app.errors.resolve(err)
+	if app.Config.ErrorFormat != ErrorFormatProblem {
+		return response, status, header
+	}
+	return newProblem(app.Config.ProblemTypeURI, matched, response, status), status, header
+}
+
+// newProblem makes a problem details document for the error that was resolved into the response and
+// status code. The response message becomes the problem detail, while the fields of the errors
+// defined in this package and any other response fields become extension members.
+func newProblem(typeURI string, err error, response Response, status int) Problem {
+	problem := Problem{
+		"type":   problemType(typeURI, err, status),
+		"title":  http.StatusText(status),
+		"status": status,
+	}
+	switch e := err.(type) {
+	case MissingFieldError:
+		problem["field"] = e.Field
+	case InvalidFormatError:
+		problem["field"] = e.Field
+		problem["value"] = e.Value
+	case InvalidParameterError:
+		problem["field"] = e.Field
+		problem["value"] = e.Value
+	case UnsafeFieldError:
+		problem["field"] = e.Field
+		problem["description"] = e.Description
+	}
+	for k, v := range response {
+		if k == "message" {
+			problem["detail"] = v
+			continue
+		}
+		problem[k] = v
+	}
+	return problem
+}
+
+// problemType returns the URI identifying the problem type of the error. If no base URI is configured
+// the type is "about:blank", meaning that the problem is fully described by the status code.
+// Otherwise it is the base URI followed by the kind of error, e.g. ".../missing-field".
+func problemType(baseURI string, err error, status int) string {
+	if baseURI == "" {
+		return "about:blank"
+	}
+	var kind string
+	switch err.(type) {
+	case GenericAPIError:
+		kind = "bad-request"
+	case MissingFieldError:
+		kind = "missing-field"
+	case InvalidFormatError:
+		kind = "invalid-format"
+	case InvalidParameterError:
+		kind = "invalid-parameter"
+	case UnsafeFieldError:
+		kind = "unsafe-field"
+	case RateLimitError:
+		kind = "rate-limited"
+	case ValidationErrors:
+		kind = "invalid-parameters"
+	case BatchTooLargeError:
+		kind = "batch-too-large"
+	default:
+		kind = strings.ToLower(strings.Replace(http.StatusText(status), " ", "-", -1))
+	}
+	return strings.TrimSuffix(baseURI, "/") + "/" + kind
+}
@@ -0,0 +1,115 @@
+package scroll
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/pkg/errors"
+	. "gopkg.in/check.v1"
+)
+
+type ProblemSuite struct{}
+
+var _ = Suite(&ProblemSuite{})
+
+func (s *ProblemSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *ProblemSuite) reply(c *C, config AppConfig, err error) (*httptest.ResponseRecorder, Response) {
+	config.Name = "test"
+	app, e := NewAppWithConfig(config)
+	c.Assert(e, IsNil)
+
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return nil, err
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	w := httptest.NewRecorder()
+	MakeHandler(app, fn, Spec{})(w, r)
+
+	var response Response
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &response), IsNil)
+	c.Assert(response["request_id"], Equals, "test")
+	delete(response, "request_id")
+	return w, response
+}
+
+func (s *ProblemSuite) TestProblem(c *C) {
+	config := AppConfig{ErrorFormat: ErrorFormatProblem, ProblemTypeURI: "https://example.com/errors/"}
+	for i, tc := range []struct {
+		err     error
+		problem Response
+	}{{
+		err: MissingFieldError{"to"},
+		problem: Response{
+			"type":   "https://example.com/errors/missing-field",
+			"title":  "Bad Request",
+			"status": float64(400),
+			"detail": "Missing mandatory parameter: to",
+			"field":  "to",
+		},
+	}, {
+		err: errors.Wrap(InvalidFormatError{"limit", "ten"}, "while parsing"),
+		problem: Response{
+			"type":   "https://example.com/errors/invalid-format",
+			"title":  "Bad Request",
+			"status": float64(400),
+			"detail": "Invalid format for parameter limit: ten",
+			"field":  "limit",
+			"value":  "ten",
+		},
+	}, {
+		err: UnsafeFieldError{"name", "character \"!\" not allowed"},
+		problem: Response{
+			"type":        "https://example.com/errors/unsafe-field",
+			"title":       "Bad Request",
+			"status":      float64(400),
+			"detail":      "field \"name\" is unsafe: character \"!\" not allowed",
+			"field":       "name",
+			"description": "character \"!\" not allowed",
+		},
+	}, {
+		err: quotaError{7},
+		problem: Response{
+			"type":   "https://example.com/errors/payment-required",
+			"title":  "Payment Required",
+			"status": float64(402),
+			"detail": "quota exceeded",
+			"used":   float64(7),
+		},
+	}, {
+		err: errors.New("database is on fire"),
+		problem: Response{
+			"type":   "https://example.com/errors/internal-server-error",
+			"title":  "Internal Server Error",
+			"status": float64(500),
+			"detail": "Internal Server Error",
+		},
+	}} {
+		c.Logf("Test case #%d", i)
+		w, problem := s.reply(c, config, tc.err)
+		c.Assert(w.Header().Get("Content-Type"), Equals, "application/problem+json")
+		c.Assert(problem, DeepEquals, tc.problem)
+	}
+}
+
+func (s *ProblemSuite) TestAboutBlank(c *C) {
+	w, problem := s.reply(c, AppConfig{ErrorFormat: ErrorFormatProblem}, NotFoundError{"no such user"})
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+	c.Assert(problem, DeepEquals, Response{
+		"type":   "about:blank",
+		"title":  "Not Found",
+		"status": float64(404),
+		"detail": "no such user",
+	})
+}
+
+func (s *ProblemSuite) TestMessageByDefault(c *C) {
+	w, response := s.reply(c, AppConfig{}, MissingFieldError{"to"})
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json; charset=utf-8")
+	c.Assert(response, DeepEquals, Response{"message": "Missing mandatory parameter: to"})
+}
@@ -0,0 +1,119 @@
+package scroll
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Upper bounds of the request duration histogram buckets, in seconds, unless others are provided.
+var DefaultPrometheusBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusStats is a StatsBackend that collects the stats of the requests with the Prometheus client
+// and exposes them in the Prometheus exposition format. Apps configured with it serve the stats at
+// /_metrics, e.g.:
+//
+//  app, err := scroll.NewAppWithConfig(scroll.AppConfig{
+//      Name:  "users",
+//      Stats: scroll.NewPrometheusStats("users", nil),
+//  })
+//
+// The stats are labelled with the path template of the route rather than the request path, so the
+// number of series stays bounded.
+type PrometheusStats struct {
+	handler http.Handler
+
+	durations     *prometheus.HistogramVec
+	requests      *prometheus.CounterVec
+	failures      *prometheus.CounterVec
+	requestBytes  *prometheus.CounterVec
+	responseBytes *prometheus.CounterVec
+	inFlight      *prometheus.GaugeVec
+	panics        *prometheus.CounterVec
+	batches       *prometheus.CounterVec
+	batchItems    *prometheus.CounterVec
+}
+
+// NewPrometheusStats creates a backend with metric names prefixed with the namespace, e.g.
+// "users_http_request_duration_seconds". If buckets are not provided DefaultPrometheusBuckets are used.
+func NewPrometheusStats(namespace string, buckets []float64) *PrometheusStats {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labels)
+	}
+	p := &PrometheusStats{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time it took to serve the requests.",
+			Buckets:   buckets,
+		}, []string{"route", "method", "status"}),
+		requests:      counter("http_requests_total", "Number of the requests served by status class.", "route", "method", "class"),
+		failures:      counter("http_request_failures_total", "Number of the requests that failed.", "route", "method"),
+		requestBytes:  counter("http_request_bytes_total", "Size of the request bodies read.", "route", "method"),
+		responseBytes: counter("http_response_bytes_total", "Size of the response bodies written.", "route", "method"),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of the requests being served.",
+		}, []string{"route", "method"}),
+		panics:     counter("http_panics_total", "Number of the requests that made handlers panic.", "route", "method"),
+		batches:    counter("http_batches_total", "Number of the batches processed.", "route", "method"),
+		batchItems: counter("http_batch_items_total", "Number of the batch items processed.", "route", "method", "result"),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(p.durations, p.requests, p.failures, p.requestBytes, p.responseBytes,
+		p.inFlight, p.panics, p.batches, p.batchItems)
+	p.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return p
+}
+
+func (p *PrometheusStats) TrackRequest(stats RequestStats) {
+	route := routeLabel(stats)
+	failed := 0.0
+	if stats.Failed {
+		failed = 1
+	}
+	p.durations.WithLabelValues(route, stats.Method, strconv.Itoa(stats.Status)).Observe(stats.Duration.Seconds())
+	p.requests.WithLabelValues(route, stats.Method, stats.StatusClass()).Inc()
+	p.failures.WithLabelValues(route, stats.Method).Add(failed)
+	p.requestBytes.WithLabelValues(route, stats.Method).Add(float64(stats.RequestBytes))
+	p.responseBytes.WithLabelValues(route, stats.Method).Add(float64(stats.ResponseBytes))
+}
+
+func (p *PrometheusStats) TrackInFlight(stats RequestStats, delta int) {
+	p.inFlight.WithLabelValues(routeLabel(stats), stats.Method).Add(float64(delta))
+}
+
+func (p *PrometheusStats) TrackPanic(stats RequestStats) {
+	p.panics.WithLabelValues(routeLabel(stats), stats.Method).Inc()
+}
+
+func (p *PrometheusStats) TrackBatch(stats RequestStats, size, failed int) {
+	route := routeLabel(stats)
+	p.batches.WithLabelValues(route, stats.Method).Inc()
+	p.batchItems.WithLabelValues(route, stats.Method, "succeeded").Add(float64(size - failed))
+	p.batchItems.WithLabelValues(route, stats.Method, "failed").Add(float64(failed))
+}
+
+// ServeHTTP writes the stats in the exposition format negotiated with the scraper.
+func (p *PrometheusStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+// routeLabel returns the value of the route label: the path template of the route, or the metric ID
+// if the request was not routed by mux.
+func routeLabel(stats RequestStats) string {
+	if stats.Route != "" {
+		return stats.Route
+	}
+	return stats.Metric
+}
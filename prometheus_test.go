@@ -0,0 +1,180 @@
+package scroll
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	. "gopkg.in/check.v1"
+)
+
+type PrometheusSuite struct{}
+
+var _ = Suite(&PrometheusSuite{})
+
+func (s *PrometheusSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *PrometheusSuite) TestMetricsEndpoint(c *C) {
+	stats := NewPrometheusStats("test", []float64{1, 0.1})
+	app, err := NewAppWithConfig(AppConfig{Name: "test", Stats: stats})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/v3/{domain}/events"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			if params["domain"] == "missing.com" {
+				return nil, NotFoundError{"no such domain"}
+			}
+			return Response{}, nil
+		},
+	}), IsNil)
+
+	for _, path := range []string{"/v3/a.com/events", "/v3/b.com/events", "/v3/missing.com/events"} {
+		app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	stats.TrackRequest(RequestStats{Metric: "slow", Method: "POST", Status: 200, Duration: 500 * time.Millisecond})
+	stats.TrackBatch(RequestStats{Metric: "batch", Method: "POST"}, 10, 3)
+
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+
+	families := parseMetrics(c, w.Body)
+	c.Assert(families["test_http_request_duration_seconds"].GetType(), Equals, dto.MetricType_HISTOGRAM)
+	h := findMetric(families, "test_http_request_duration_seconds", "route", "/v3/{domain}/events", "method", "GET", "status", "200").GetHistogram()
+	c.Assert(h.GetSampleCount(), Equals, uint64(2))
+	c.Assert(h.GetBucket()[0].GetUpperBound(), Equals, 0.1)
+	c.Assert(h.GetBucket()[0].GetCumulativeCount(), Equals, uint64(2))
+	h = findMetric(families, "test_http_request_duration_seconds", "route", "/v3/{domain}/events", "method", "GET", "status", "404").GetHistogram()
+	c.Assert(h.GetSampleCount(), Equals, uint64(1))
+	h = findMetric(families, "test_http_request_duration_seconds", "route", "slow", "method", "POST", "status", "200").GetHistogram()
+	c.Assert(h.GetBucket()[0].GetCumulativeCount(), Equals, uint64(0))
+	c.Assert(h.GetBucket()[1].GetUpperBound(), Equals, 1.0)
+	c.Assert(h.GetBucket()[1].GetCumulativeCount(), Equals, uint64(1))
+	c.Assert(h.GetSampleSum(), Equals, 0.5)
+
+	c.Assert(families["test_http_requests_in_flight"].GetType(), Equals, dto.MetricType_GAUGE)
+	c.Assert(findMetric(families, "test_http_requests_in_flight", "route", "/v3/{domain}/events", "method", "GET").GetGauge().GetValue(), Equals, 0.0)
+	c.Assert(findMetric(families, "test_http_batches_total", "route", "batch", "method", "POST").GetCounter().GetValue(), Equals, 1.0)
+	c.Assert(findMetric(families, "test_http_batch_items_total", "route", "batch", "method", "POST", "result", "failed").GetCounter().GetValue(), Equals, 3.0)
+	c.Assert(findMetric(families, "test_http_batch_items_total", "route", "batch", "method", "POST", "result", "succeeded").GetCounter().GetValue(), Equals, 7.0)
+}
+
+func (s *PrometheusSuite) TestInFlight(c *C) {
+	stats := NewPrometheusStats("", nil)
+	route := RequestStats{Method: "GET", Route: "/users/{id}"}
+	stats.TrackInFlight(route, 1)
+	stats.TrackInFlight(route, 1)
+	stats.TrackInFlight(route, -1)
+
+	families := scrapeMetrics(c, stats)
+	c.Assert(findMetric(families, "http_requests_in_flight", "route", "/users/{id}", "method", "GET").GetGauge().GetValue(), Equals, 1.0)
+}
+
+func (s *PrometheusSuite) TestStatusClasses(c *C) {
+	for i, tc := range []struct {
+		success  func(int) bool
+		failures float64
+	}{
+		{success: nil, failures: 1},
+		{success: func(status int) bool { return status == http.StatusOK }, failures: 3},
+	} {
+		c.Logf("Test case #%d", i)
+		stats := NewPrometheusStats("", nil)
+		appStats := newAppStats(nil, stats, tc.success)
+		route := RequestStats{Method: "POST", Route: "/users"}
+		for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusBadRequest} {
+			appStats.TrackRequest(route, status, time.Millisecond, 10, 20)
+		}
+
+		families := scrapeMetrics(c, stats)
+		for _, expected := range []struct {
+			name   string
+			labels []string
+			value  float64
+		}{
+			{"http_requests_total", []string{"route", "/users", "method", "POST", "class", "2xx"}, 3},
+			{"http_requests_total", []string{"route", "/users", "method", "POST", "class", "4xx"}, 1},
+			{"http_request_failures_total", []string{"route", "/users", "method", "POST"}, tc.failures},
+			{"http_request_bytes_total", []string{"route", "/users", "method", "POST"}, 40},
+			{"http_response_bytes_total", []string{"route", "/users", "method", "POST"}, 80},
+		} {
+			c.Assert(findMetric(families, expected.name, expected.labels...).GetCounter().GetValue(), Equals, expected.value,
+				Commentf("%v%v", expected.name, expected.labels))
+		}
+	}
+}
+
+func (s *PrometheusSuite) TestBytes(c *C) {
+	stats := NewPrometheusStats("", nil)
+	app, err := NewAppWithConfig(AppConfig{Name: "test", Stats: stats})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"POST"},
+		Paths:   []string{"/users"},
+		HandlerWithBody: func(w http.ResponseWriter, r *http.Request, params map[string]string, body []byte) (interface{}, error) {
+			return Response{"size": len(body)}, nil
+		},
+	}), IsNil)
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"bob"}`)))
+
+	families := scrapeMetrics(c, stats)
+	c.Assert(findMetric(families, "http_request_bytes_total", "route", "/users", "method", "POST").GetCounter().GetValue(), Equals, 14.0)
+	c.Assert(findMetric(families, "http_response_bytes_total", "route", "/users", "method", "POST").GetCounter().GetValue(), Equals, 11.0)
+}
+
+func (s *PrometheusSuite) TestNoMetricsEndpoint(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
+
+// scrapeMetrics parses the stats served by the backend.
+func scrapeMetrics(c *C, stats *PrometheusStats) map[string]*dto.MetricFamily {
+	w := httptest.NewRecorder()
+	stats.ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	return parseMetrics(c, w.Body)
+}
+
+// parseMetrics parses the metric families of the Prometheus text format.
+func parseMetrics(c *C, r io.Reader) map[string]*dto.MetricFamily {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	c.Assert(err, IsNil)
+	return families
+}
+
+// findMetric returns the metric of the family with exactly the labels, given as name/value pairs,
+// or nil if there is none.
+func findMetric(families map[string]*dto.MetricFamily, name string, labels ...string) *dto.Metric {
+	for _, m := range families[name].GetMetric() {
+		if len(m.GetLabel())*2 != len(labels) {
+			continue
+		}
+		matches := true
+		for i := 0; i < len(labels); i += 2 {
+			found := false
+			for _, l := range m.GetLabel() {
+				if l.GetName() == labels[i] && l.GetValue() == labels[i+1] {
+					found = true
+				}
+			}
+			matches = matches && found
+		}
+		if matches {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package scroll
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/mailgun/log"
+)
+
+// panicError is the error a handler is considered to fail with when it panics.
+type panicError struct {
+	value interface{}
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// recoverPanics wraps the handler made for the spec, including its middlewares, so that a panic
+// does not kill the connection. Handler functions other than RawHandler have their panics recovered
+// by serveRequest already, so this catches panics of raw handlers, middlewares and streams. The
+// panic is logged with its stack and counted, the request is logged as failed and, unless the
+// handler has already started writing the response, the reply is the standard "Internal Server
+// Error". Requests of the handlers other than RawHandler are also tracked in the request stats.
+//
+// Panics with http.ErrAbortHandler are not recovered, because they abort the response on purpose.
+func (app *App) recoverPanics(spec Spec, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriter(w)
+		start := time.Now()
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			err := app.handlePanic(r, spec, p)
+			traceError(r, err)
+			elapsedTime := time.Since(start)
+			app.logRequest(spec, r, rw, http.StatusInternalServerError, elapsedTime, err)
+			if spec.RawHandler == nil {
+				app.stats.TrackRequest(requestStats(spec, r), http.StatusInternalServerError, elapsedTime, 0, rw.bytes)
+			}
+			if !rw.wroteHeader {
+				response, status := app.errorResponse(w, err)
+				app.Reply(w, r, response, status)
+			}
+		}()
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// handlePanic logs the recovered panic value with the stack of the panicking goroutine and counts it.
+// Returns the error the request is considered to fail with.
+func (app *App) handlePanic(r *http.Request, spec Spec, p interface{}) error {
+	log.Errorf("Panic while serving %v %v (metric=%v, request_id=%v): %v\n%s",
+		r.Method, r.URL, metricID(spec, r), RequestID(r), p, debug.Stack())
+	app.stats.TrackPanic(requestStats(spec, r))
+	return panicError{p}
+}
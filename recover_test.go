@@ -0,0 +1,132 @@
+package scroll
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type RecoverSuite struct {
+	app *App
+}
+
+var _ = Suite(&RecoverSuite{})
+
+func (s *RecoverSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *RecoverSuite) SetUpTest(c *C) {
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+}
+
+func (s *RecoverSuite) serve(spec Spec) *httptest.ResponseRecorder {
+	spec.Methods = []string{"GET"}
+	spec.Paths = []string{"/panic"}
+	if err := s.app.AddHandler(spec); err != nil {
+		panic(err)
+	}
+	r := httptest.NewRequest("GET", "/panic", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	w := httptest.NewRecorder()
+	s.app.GetHandler().ServeHTTP(w, r)
+	return w
+}
+
+func (s *RecoverSuite) TestHandlerPanic(c *C) {
+	var logged error
+	LogRequest = func(r *http.Request, status int, elapsedTime time.Duration, err error) { logged = err }
+	defer func() { LogRequest = logRequest }()
+
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		panic("boom")
+	}
+	r := httptest.NewRequest("GET", "/panic", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	w := httptest.NewRecorder()
+	MakeHandler(s.app, fn, Spec{})(w, r)
+
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(w.Body.String(), Equals, `{"message":"Internal Server Error","request_id":"test"}`)
+	c.Assert(logged, ErrorMatches, "panic: boom")
+}
+
+func (s *RecoverSuite) TestRawHandlerPanic(c *C) {
+	w := s.serve(Spec{RawHandler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}})
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(w.Body.String(), Equals, `{"message":"Internal Server Error","request_id":"test"}`)
+}
+
+// Handlers abort responses with http.ErrAbortHandler, which net/http recovers without logging.
+func (s *RecoverSuite) TestAbortHandler(c *C) {
+	stats := NewPrometheusStats("", nil)
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test", Stats: stats})
+	c.Assert(err, IsNil)
+	c.Assert(func() {
+		s.serve(Spec{RawHandler: func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}})
+	}, Panics, http.ErrAbortHandler)
+
+	c.Assert(s.app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/abort"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			panic(http.ErrAbortHandler)
+		},
+	}), IsNil)
+	c.Assert(func() {
+		s.app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+	}, Panics, http.ErrAbortHandler)
+
+	w := httptest.NewRecorder()
+	stats.ServeHTTP(w, httptest.NewRequest("GET", "/_metrics", nil))
+	c.Assert(strings.Contains(w.Body.String(), "http_panics_total{"), Equals, false)
+}
+
+func (s *RecoverSuite) TestPanicAfterWrite(c *C) {
+	w := s.serve(Spec{RawHandler: func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("boom")
+	}})
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+	c.Assert(w.Body.String(), Equals, "partial")
+}
+
+func (s *RecoverSuite) TestMiddlewarePanic(c *C) {
+	s.app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+	})
+	w := s.serve(Spec{Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return Response{}, nil
+	}})
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+}
+
+func (s *RecoverSuite) TestBatchItemPanic(c *C) {
+	fn := func(r *http.Request, params map[string]string, item interface{}) (interface{}, error) {
+		if *item.(*int) == 2 {
+			panic("boom")
+		}
+		return "ok", nil
+	}
+	r := httptest.NewRequest("POST", "/batch", strings.NewReader("[1, 2]"))
+	w := httptest.NewRecorder()
+	MakeBatchHandler(s.app, fn, Spec{BatchItem: 0})(w, r)
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"failed":1,"items":[{"index":0,"status":200,"result":"ok"},`+
+		`{"index":1,"status":500,"error":{"message":"Internal Server Error"}}]}`)
+}
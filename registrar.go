@@ -0,0 +1,32 @@
+package scroll
+
+import (
+	"github.com/mailgun/scroll/vulcand"
+)
+
+// Registrar publishes an app and its handlers for service discovery, so that a proxy or a load
+// balancer routes requests to the app. The app registers when it starts running and deregisters
+// when it shuts down.
+//
+// *vulcand.Registry is the registrar used unless AppConfig.Registrar is provided. The registrar
+// package has registrars for other environments, e.g. a Consul agent or a static file.
+type Registrar interface {
+	// Start registers the app and keeps it registered until Stop is called.
+	Start() error
+
+	// Stop deregisters the app.
+	Stop()
+
+	// AddFrontend publishes the route of a handler with the middlewares of its spec. It is called
+	// for the handlers added before the registrar is started as well as for the handlers added
+	// while the app is running.
+	AddFrontend(host, path string, methods []string, middlewares []vulcand.Middleware) error
+
+	// RemoveFrontend withdraws the route of a removed handler.
+	RemoveFrontend(host, path string, methods []string) error
+
+	// Healthy returns an error if the app is not registered at the moment.
+	Healthy() error
+}
+
+var _ Registrar = (*vulcand.Registry)(nil)
@@ -0,0 +1,272 @@
+package registrar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/log"
+	"github.com/mailgun/scroll/vulcand"
+)
+
+const (
+	defaultConsulAddress = "http://127.0.0.1:8500"
+	defaultConsulTTL     = 30 * time.Second
+	defaultConsulTimeout = 10 * time.Second
+)
+
+// ConsulConfig configures the registration of an app with a Consul agent.
+type ConsulConfig struct {
+	// URL of the HTTP API of the agent, "http://127.0.0.1:8500" if not specified.
+	Address string
+
+	// ACL token to register with, if the agent requires one.
+	Token string
+
+	// TTL of the health check of the service; the service is kept passing by heartbeats sent three times
+	// per TTL. 30 seconds if not specified.
+	TTL time.Duration
+
+	// Time after which the agent deregisters the service if its health check is critical, e.g. because
+	// the app was killed. The service is not deregistered by the agent if not specified.
+	DeregisterCriticalAfter time.Duration
+
+	// HTTP client to call the agent with, a client with a 10 second timeout if not specified.
+	Client *http.Client
+}
+
+// Consul is a registrar that registers app instances as services of a Consul agent with a TTL health
+// check. Consul has no notion of frontends, so the routes of the handlers are published as tags of the
+// service, e.g. "route=GET api.example.com/v3/{domain}/events", for a router to build its routes from.
+type Consul struct {
+	cfg       ConsulConfig
+	app       string
+	server    Server
+	address   string
+	port      int
+	frontends frontendSet
+
+	// Serializes the calls to the agent, so that an older set of routes never overwrites a newer one.
+	callMu sync.Mutex
+
+	// Guards the state of the registration. It is never held while calling the agent, so that Healthy
+	// does not wait for a slow agent.
+	mu      sync.Mutex
+	running bool
+	err     error
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// consulService is the service definition of the agent API.
+type consulService struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+	Check   consulCheck
+}
+
+type consulCheck struct {
+	CheckID                        string
+	TTL                            string
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
+}
+
+// NewConsul creates a registrar that registers the app listening on the IP and port with the agent.
+func NewConsul(cfg ConsulConfig, appName, ip string, port int) (*Consul, error) {
+	if cfg.Address == "" {
+		cfg.Address = defaultConsulAddress
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultConsulTTL
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultConsulTimeout}
+	}
+	server, err := newServer(ip, port)
+	if err != nil {
+		return nil, err
+	}
+	address, err := advertisedIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	return &Consul{cfg: cfg, app: appName, server: server, address: address, port: port}, nil
+}
+
+func (c *Consul) Start() error {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	if err := c.register(); err != nil {
+		return err
+	}
+	if err := c.pass(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running, c.err = true, nil
+	c.done = make(chan struct{})
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.cfg.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.heartbeat()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *Consul) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	close(c.done)
+	c.mu.Unlock()
+	c.wg.Wait()
+
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	err := c.call("PUT", "/v1/agent/service/deregister/"+url.PathEscape(c.server.ID), nil)
+	log.Infof("consul service deregistered id=%v err=(%v)", c.server.ID, err)
+}
+
+func (c *Consul) AddFrontend(host, path string, methods []string, middlewares []vulcand.Middleware) error {
+	c.frontends.add(host, path, methods, middlewares)
+	return c.update()
+}
+
+func (c *Consul) RemoveFrontend(host, path string, methods []string) error {
+	if err := c.frontends.remove(host, path, methods); err != nil {
+		return err
+	}
+	return c.update()
+}
+
+func (c *Consul) Healthy() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running {
+		return errors.New("consul registration is not running")
+	}
+	return c.err
+}
+
+// update registers the service again with the current frontends if the app is running.
+func (c *Consul) update() error {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	if !c.isRunning() {
+		return nil
+	}
+	return c.register()
+}
+
+// heartbeat keeps the health check of the service passing. If the agent lost the service, e.g.
+// because it restarted, the service is registered again.
+func (c *Consul) heartbeat() {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	if !c.isRunning() {
+		return
+	}
+	err := c.pass()
+	if err != nil {
+		log.Errorf("consul heartbeat failed: %v", err)
+		if regErr := c.register(); regErr != nil {
+			log.Errorf("while registering with consul again: %v", regErr)
+		} else {
+			err = c.pass()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *Consul) isRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+func (c *Consul) register() error {
+	tags := []string{}
+	for _, fe := range c.frontends.list() {
+		tags = append(tags, fmt.Sprintf("route=%s %s%s", strings.Join(fe.Methods, ","), fe.Host, fe.Path))
+	}
+	check := consulCheck{CheckID: c.checkID(), TTL: c.cfg.TTL.String()}
+	if c.cfg.DeregisterCriticalAfter > 0 {
+		check.DeregisterCriticalServiceAfter = c.cfg.DeregisterCriticalAfter.String()
+	}
+	service := consulService{
+		ID:      c.server.ID,
+		Name:    c.app,
+		Address: c.address,
+		Port:    c.port,
+		Tags:    tags,
+		Meta:    map[string]string{"url": c.server.URL},
+		Check:   check,
+	}
+	body, err := json.Marshal(service)
+	if err != nil {
+		return fmt.Errorf("failed to marshal consul service: %v", err)
+	}
+	return c.call("PUT", "/v1/agent/service/register", bytes.NewReader(body))
+}
+
+func (c *Consul) pass() error {
+	return c.call("PUT", "/v1/agent/check/pass/"+url.PathEscape(c.checkID()), nil)
+}
+
+func (c *Consul) checkID() string {
+	return "service:" + c.server.ID
+}
+
+// call makes a request to the agent API and returns an error unless it succeeds.
+func (c *Consul) call(method, path string, body io.Reader) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.cfg.Address, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to make consul request: %v", err)
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul request failed: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("consul request failed: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
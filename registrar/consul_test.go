@@ -0,0 +1,204 @@
+package registrar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConsulSuite struct {
+	agent  *fakeAgent
+	server *httptest.Server
+}
+
+var _ = Suite(&ConsulSuite{})
+
+func (s *ConsulSuite) SetUpTest(c *C) {
+	s.agent = &fakeAgent{services: make(map[string]consulService), passes: make(map[string]int)}
+	s.server = httptest.NewServer(s.agent)
+}
+
+func (s *ConsulSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *ConsulSuite) TestRegister(c *C) {
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL, Token: "secret", DeregisterCriticalAfter: time.Minute},
+		"users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.AddFrontend("api.example.com", "/users", []string{"POST", "GET"}, nil), IsNil)
+	c.Assert(reg.Healthy(), ErrorMatches, "consul registration is not running")
+
+	c.Assert(reg.Start(), IsNil)
+	defer reg.Stop()
+	c.Assert(reg.Healthy(), IsNil)
+
+	service, ok := s.agent.service(reg.server.ID)
+	c.Assert(ok, Equals, true)
+	c.Assert(service.Name, Equals, "users")
+	c.Assert(service.Address, Equals, "127.0.0.1")
+	c.Assert(service.Port, Equals, 8080)
+	c.Assert(service.Tags, DeepEquals, []string{"route=GET,POST api.example.com/users"})
+	c.Assert(service.Check, DeepEquals, consulCheck{
+		CheckID: "service:" + reg.server.ID, TTL: "30s", DeregisterCriticalServiceAfter: "1m0s"})
+	c.Assert(s.agent.passCount("service:"+reg.server.ID), Equals, 1)
+	c.Assert(s.agent.lastToken(), Equals, "secret")
+
+	// Frontends changed at runtime re-register the service.
+	c.Assert(reg.AddFrontend("api.example.com", "/users/{id}", []string{"GET"}, nil), IsNil)
+	c.Assert(reg.RemoveFrontend("api.example.com", "/users", []string{"GET", "POST"}), IsNil)
+	service, _ = s.agent.service(reg.server.ID)
+	c.Assert(service.Tags, DeepEquals, []string{"route=GET api.example.com/users/{id}"})
+}
+
+func (s *ConsulSuite) TestDeregister(c *C) {
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL}, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), IsNil)
+	reg.Stop()
+
+	_, ok := s.agent.service(reg.server.ID)
+	c.Assert(ok, Equals, false)
+	c.Assert(reg.Healthy(), NotNil)
+}
+
+func (s *ConsulSuite) TestHeartbeat(c *C) {
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL, TTL: 30 * time.Millisecond}, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), IsNil)
+	defer reg.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(s.agent.passCount("service:"+reg.server.ID) > 2, Equals, true)
+
+	// If the agent loses the service, e.g. when it restarts, the service is registered again.
+	s.agent.forget(reg.server.ID)
+	time.Sleep(50 * time.Millisecond)
+	_, ok := s.agent.service(reg.server.ID)
+	c.Assert(ok, Equals, true)
+	c.Assert(reg.Healthy(), IsNil)
+}
+
+func (s *ConsulSuite) TestAgentDown(c *C) {
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL, TTL: 30 * time.Millisecond}, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), IsNil)
+	defer reg.Stop()
+
+	s.server.Close()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(reg.Healthy(), ErrorMatches, "consul request failed: PUT /v1/agent/check/pass/.*")
+}
+
+// A slow agent does not block the health checks of the app.
+func (s *ConsulSuite) TestSlowAgent(c *C) {
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL, TTL: 30 * time.Millisecond}, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), IsNil)
+	defer reg.Stop()
+
+	release := make(chan struct{})
+	s.agent.block(release)
+	defer close(release)
+	time.Sleep(50 * time.Millisecond)
+
+	healthy := make(chan error)
+	go func() { healthy <- reg.Healthy() }()
+	select {
+	case err := <-healthy:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Healthy is blocked by the agent")
+	}
+}
+
+func (s *ConsulSuite) TestStartFails(c *C) {
+	s.server.Close()
+	reg, err := NewConsul(ConsulConfig{Address: s.server.URL}, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), ErrorMatches, "consul request failed: PUT /v1/agent/service/register: .*")
+	c.Assert(reg.Healthy(), NotNil)
+}
+
+// fakeAgent is an in-process stand-in for the service registration endpoints of a Consul agent.
+type fakeAgent struct {
+	mu       sync.Mutex
+	services map[string]consulService
+	passes   map[string]int
+	token    string
+	blocked  chan struct{}
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	blocked := a.blocked
+	a.mu.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = r.Header.Get("X-Consul-Token")
+	if r.Method != "PUT" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var service consulService
+		if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.services[service.ID] = service
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(a.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")
+		if _, ok := a.services[strings.TrimPrefix(id, "service:")]; !ok {
+			http.Error(w, "Unknown check "+id, http.StatusInternalServerError)
+			return
+		}
+		a.passes[id]++
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeAgent) service(id string) (consulService, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	service, ok := a.services[id]
+	return service, ok
+}
+
+// block makes the agent hold the requests until the channel is closed.
+func (a *fakeAgent) block(release chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.blocked = release
+}
+
+func (a *fakeAgent) forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.services, id)
+}
+
+func (a *fakeAgent) passCount(id string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.passes[id]
+}
+
+func (a *fakeAgent) lastToken() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.token
+}
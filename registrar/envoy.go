@@ -0,0 +1,216 @@
+package registrar
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	envoyRouteType   = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+	envoyClusterType = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+)
+
+// EnvoySnapshot is a discovery response of the Envoy xDS v3 API with the route configuration and the
+// cluster of an app instance. The route configuration has a virtual host per frontend host and the
+// cluster is named after the app.
+type EnvoySnapshot struct {
+	VersionInfo string        `json:"version_info"`
+	Resources   []interface{} `json:"resources"`
+}
+
+type envoyRouteConfig struct {
+	Type         string             `json:"@type"`
+	Name         string             `json:"name"`
+	VirtualHosts []envoyVirtualHost `json:"virtual_hosts"`
+}
+
+type envoyVirtualHost struct {
+	Name    string       `json:"name"`
+	Domains []string     `json:"domains"`
+	Routes  []envoyRoute `json:"routes"`
+}
+
+type envoyRoute struct {
+	Name     string                 `json:"name"`
+	Match    envoyRouteMatch        `json:"match"`
+	Route    envoyRouteAction       `json:"route"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type envoyRouteMatch struct {
+	SafeRegex envoyRegex           `json:"safe_regex"`
+	Headers   []envoyHeaderMatcher `json:"headers,omitempty"`
+}
+
+type envoyHeaderMatcher struct {
+	Name        string           `json:"name"`
+	StringMatch envoyStringMatch `json:"string_match"`
+}
+
+type envoyStringMatch struct {
+	SafeRegex envoyRegex `json:"safe_regex"`
+}
+
+type envoyRegex struct {
+	Regex string `json:"regex"`
+}
+
+type envoyRouteAction struct {
+	Cluster string `json:"cluster"`
+}
+
+type envoyCluster struct {
+	Type           string              `json:"@type"`
+	Name           string              `json:"name"`
+	DiscoveryType  string              `json:"type"`
+	LoadAssignment envoyLoadAssignment `json:"load_assignment"`
+}
+
+type envoyLoadAssignment struct {
+	ClusterName string                   `json:"cluster_name"`
+	Endpoints   []envoyLocalityEndpoints `json:"endpoints"`
+}
+
+type envoyLocalityEndpoints struct {
+	LbEndpoints []envoyLbEndpoint `json:"lb_endpoints"`
+}
+
+type envoyLbEndpoint struct {
+	Endpoint envoyEndpoint `json:"endpoint"`
+}
+
+type envoyEndpoint struct {
+	Address envoyAddress `json:"address"`
+}
+
+type envoyAddress struct {
+	SocketAddress envoySocketAddress `json:"socket_address"`
+}
+
+type envoySocketAddress struct {
+	Address   string `json:"address"`
+	PortValue int    `json:"port_value"`
+}
+
+// NewEnvoySnapshot makes the Envoy configuration of the catalog. A route matches the path template of
+// the frontend converted to a regular expression, e.g. "/v3/{domain}/events" to "^/v3/[^/]+/events$",
+// and the methods with the ":method" header. Envoy has no equivalent of vulcand middlewares, so the IDs
+// of the middlewares of a route are listed in its metadata under "scroll" for filters to act on.
+//
+// The version of the snapshot is the hash of its resources, so it changes whenever the frontends do.
+func NewEnvoySnapshot(catalog Catalog) (EnvoySnapshot, error) {
+	cluster, err := newEnvoyCluster(catalog.App, catalog.Server)
+	if err != nil {
+		return EnvoySnapshot{}, err
+	}
+
+	routeConfig := envoyRouteConfig{Type: envoyRouteType, Name: catalog.App, VirtualHosts: []envoyVirtualHost{}}
+	hosts := make(map[string]int)
+	for _, fe := range catalog.Frontends {
+		i, ok := hosts[fe.Host]
+		if !ok {
+			domain := fe.Host
+			if domain == "" {
+				domain = "*"
+			}
+			i = len(routeConfig.VirtualHosts)
+			hosts[fe.Host] = i
+			routeConfig.VirtualHosts = append(routeConfig.VirtualHosts, envoyVirtualHost{Name: domain, Domains: []string{domain}})
+		}
+		route := envoyRoute{
+			Name:  routerName(catalog.App, fe),
+			Match: envoyRouteMatch{SafeRegex: envoyRegex{Regex: pathRegexp(fe.Path)}},
+			Route: envoyRouteAction{Cluster: catalog.App},
+		}
+		if len(fe.Methods) > 0 {
+			route.Match.Headers = []envoyHeaderMatcher{{
+				Name:        ":method",
+				StringMatch: envoyStringMatch{SafeRegex: envoyRegex{Regex: "^(" + strings.Join(fe.Methods, "|") + ")$"}},
+			}}
+		}
+		if len(fe.Middlewares) > 0 {
+			ids := make([]string, len(fe.Middlewares))
+			for j, mw := range fe.Middlewares {
+				ids[j] = mw.ID
+			}
+			route.Metadata = map[string]interface{}{
+				"filter_metadata": map[string]interface{}{"scroll": map[string]interface{}{"middlewares": ids}},
+			}
+		}
+		routeConfig.VirtualHosts[i].Routes = append(routeConfig.VirtualHosts[i].Routes, route)
+	}
+
+	snapshot := EnvoySnapshot{Resources: []interface{}{routeConfig, cluster}}
+	resources, err := json.Marshal(snapshot.Resources)
+	if err != nil {
+		return EnvoySnapshot{}, fmt.Errorf("failed to marshal envoy resources: %v", err)
+	}
+	snapshot.VersionInfo = fmt.Sprintf("%x", sha1.Sum(resources))
+	return snapshot, nil
+}
+
+// EnvoyJSON is a Format that encodes the catalog as the Envoy configuration, for Envoy to load with a
+// filesystem based xDS config source.
+func EnvoyJSON(catalog Catalog) ([]byte, error) {
+	snapshot, err := NewEnvoySnapshot(catalog)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(snapshot, "", "  ")
+}
+
+func newEnvoyCluster(app string, server Server) (envoyCluster, error) {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return envoyCluster{}, fmt.Errorf("failed to parse server URL: %v", err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return envoyCluster{}, fmt.Errorf("failed to parse server URL: %v", err)
+	}
+	portValue, err := strconv.Atoi(port)
+	if err != nil {
+		return envoyCluster{}, fmt.Errorf("failed to parse server URL: %v", err)
+	}
+
+	endpoint := envoyLbEndpoint{Endpoint: envoyEndpoint{Address: envoyAddress{
+		SocketAddress: envoySocketAddress{Address: host, PortValue: portValue},
+	}}}
+	return envoyCluster{
+		Type:          envoyClusterType,
+		Name:          app,
+		DiscoveryType: "STATIC",
+		LoadAssignment: envoyLoadAssignment{
+			ClusterName: app,
+			Endpoints:   []envoyLocalityEndpoints{{LbEndpoints: []envoyLbEndpoint{endpoint}}},
+		},
+	}, nil
+}
+
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(?::([^}]*))?\}`)
+
+// pathRegexp converts a gorilla/mux path template to an anchored regular expression. Path variables
+// match their regular expressions if any, or a path segment otherwise.
+func pathRegexp(path string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	last := 0
+	for _, m := range pathVariable.FindAllStringSubmatchIndex(path, -1) {
+		buf.WriteString(regexp.QuoteMeta(path[last:m[0]]))
+		if m[4] >= 0 {
+			buf.WriteString("(?:" + path[m[4]:m[5]] + ")")
+		} else {
+			buf.WriteString("[^/]+")
+		}
+		last = m[1]
+	}
+	buf.WriteString(regexp.QuoteMeta(path[last:]))
+	buf.WriteString("$")
+	return buf.String()
+}
@@ -0,0 +1,113 @@
+package registrar
+
+import (
+	"encoding/json"
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type EnvoySuite struct{}
+
+var _ = Suite(&EnvoySuite{})
+
+func (s *EnvoySuite) TestSnapshot(c *C) {
+	data, err := EnvoyJSON(testCatalog())
+	c.Assert(err, IsNil)
+	var snapshot map[string]interface{}
+	c.Assert(json.Unmarshal(data, &snapshot), IsNil)
+	c.Assert(snapshot["version_info"], Matches, "[0-9a-f]{40}")
+
+	expected := `[{
+		"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+		"name": "users",
+		"virtual_hosts": [{
+			"name": "api.example.com",
+			"domains": ["api.example.com"],
+			"routes": [{
+				"name": "users-api-example-com-get-post-v3-domain-users",
+				"match": {
+					"safe_regex": {"regex": "^/v3/[^/]+/users$"},
+					"headers": [{"name": ":method", "string_match": {"safe_regex": {"regex": "^(GET|POST)$"}}}]
+				},
+				"route": {"cluster": "users"},
+				"metadata": {"filter_metadata": {"scroll": {"middlewares": ["auth", "ratelimit"]}}}
+			}]
+		}, {
+			"name": "*",
+			"domains": ["*"],
+			"routes": [{
+				"name": "users-get-users-id-0-9",
+				"match": {
+					"safe_regex": {"regex": "^/users/(?:[0-9]+)$"},
+					"headers": [{"name": ":method", "string_match": {"safe_regex": {"regex": "^(GET)$"}}}]
+				},
+				"route": {"cluster": "users"}
+			}]
+		}]
+	}, {
+		"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+		"name": "users",
+		"type": "STATIC",
+		"load_assignment": {
+			"cluster_name": "users",
+			"endpoints": [{"lb_endpoints": [{"endpoint": {"address": {"socket_address": {"address": "10.0.0.1", "port_value": 8080}}}}]}]
+		}
+	}]`
+	var resources []interface{}
+	c.Assert(json.Unmarshal([]byte(expected), &resources), IsNil)
+	c.Assert(snapshot["resources"], DeepEquals, resources)
+}
+
+func (s *EnvoySuite) TestVersion(c *C) {
+	catalog := testCatalog()
+	first, err := NewEnvoySnapshot(catalog)
+	c.Assert(err, IsNil)
+	same, err := NewEnvoySnapshot(testCatalog())
+	c.Assert(err, IsNil)
+	c.Assert(same.VersionInfo, Equals, first.VersionInfo)
+
+	catalog.Frontends = catalog.Frontends[:1]
+	changed, err := NewEnvoySnapshot(catalog)
+	c.Assert(err, IsNil)
+	c.Assert(changed.VersionInfo, Not(Equals), first.VersionInfo)
+}
+
+func (s *EnvoySuite) TestBadServerURL(c *C) {
+	_, err := NewEnvoySnapshot(Catalog{App: "users", Server: Server{URL: "http://10.0.0.1"}})
+	c.Assert(err, ErrorMatches, "failed to parse server URL: .*")
+}
+
+func (s *EnvoySuite) TestPathRegexp(c *C) {
+	for i, tc := range []struct {
+		path    string
+		regexp  string
+		matches []string
+		misses  []string
+	}{{
+		path:    "/users",
+		regexp:  "^/users$",
+		matches: []string{"/users"},
+		misses:  []string{"/users/1", "/users2"},
+	}, {
+		path:    "/v3/{domain}/events",
+		regexp:  "^/v3/[^/]+/events$",
+		matches: []string{"/v3/example.com/events"},
+		misses:  []string{"/v3/events", "/v3/a/b/events"},
+	}, {
+		path:    "/users/{id:[0-9]+}.json",
+		regexp:  `^/users/(?:[0-9]+)\.json$`,
+		matches: []string{"/users/42.json"},
+		misses:  []string{"/users/bob.json", "/users/42xjson"},
+	}} {
+		c.Logf("Test case #%d", i)
+		c.Assert(pathRegexp(tc.path), Equals, tc.regexp)
+		re := regexp.MustCompile(tc.regexp)
+		for _, path := range tc.matches {
+			c.Assert(re.MatchString(path), Equals, true, Commentf(path))
+		}
+		for _, path := range tc.misses {
+			c.Assert(re.MatchString(path), Equals, false, Commentf(path))
+		}
+	}
+}
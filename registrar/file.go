@@ -0,0 +1,130 @@
+package registrar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mailgun/scroll/vulcand"
+)
+
+// Format encodes the catalog of an app instance as the contents of a file, e.g. the configuration of
+// a proxy routing requests to the instance.
+type Format func(Catalog) ([]byte, error)
+
+// CatalogJSON is the Format that encodes the catalog as it is.
+func CatalogJSON(catalog Catalog) ([]byte, error) {
+	return json.MarshalIndent(catalog, "", "  ")
+}
+
+// File is a registrar that publishes the catalog of an app instance as a file, e.g. for a sidecar,
+// a proxy or a configuration management tool to pick up. The file is rewritten whenever the frontends
+// change while the app is running and removed when the app deregisters.
+type File struct {
+	path      string
+	format    Format
+	app       string
+	server    Server
+	frontends frontendSet
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewFile creates a registrar that publishes the app listening on the IP and port to the file at the path
+// in the CatalogJSON format.
+func NewFile(path, appName, ip string, port int) (*File, error) {
+	return NewFileWithFormat(path, CatalogJSON, appName, ip, port)
+}
+
+// NewFileWithFormat creates a registrar that publishes the app in the format, e.g. as the configuration
+// of Traefik with TraefikJSON or of Envoy with EnvoyJSON.
+func NewFileWithFormat(path string, format Format, appName, ip string, port int) (*File, error) {
+	server, err := newServer(ip, port)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, format: format, app: appName, server: server}, nil
+}
+
+func (f *File) Start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.write(); err != nil {
+		return err
+	}
+	f.running = true
+	return nil
+}
+
+func (f *File) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running = false
+	// There is no way to report an error, but the file is rewritten on start anyway.
+	os.Remove(f.path)
+}
+
+func (f *File) AddFrontend(host, path string, methods []string, middlewares []vulcand.Middleware) error {
+	f.frontends.add(host, path, methods, middlewares)
+	return f.update()
+}
+
+func (f *File) RemoveFrontend(host, path string, methods []string) error {
+	if err := f.frontends.remove(host, path, methods); err != nil {
+		return err
+	}
+	return f.update()
+}
+
+func (f *File) Healthy() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.running {
+		return errors.New("catalog file is not published")
+	}
+	return nil
+}
+
+// update rewrites the file if the app is running.
+func (f *File) update() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.running {
+		return nil
+	}
+	return f.write()
+}
+
+// write replaces the file with the current catalog. The catalog is written to a temporary file first,
+// so that readers never see a partially written file.
+func (f *File) write() error {
+	data, err := f.format(Catalog{App: f.app, Server: f.server, Frontends: f.frontends.list()})
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create catalog file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write catalog file: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write catalog file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write catalog file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace catalog file: %v", err)
+	}
+	return nil
+}
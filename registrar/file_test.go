@@ -0,0 +1,86 @@
+package registrar
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type FileSuite struct {
+	dir  string
+	path string
+}
+
+var _ = Suite(&FileSuite{})
+
+func (s *FileSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.path = filepath.Join(s.dir, "catalog.json")
+}
+
+func (s *FileSuite) TestPublish(c *C) {
+	reg, err := NewFile(s.path, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.AddFrontend("api.example.com", "/users", []string{"GET"}, nil), IsNil)
+
+	// The file is not published until the app starts.
+	_, err = os.Stat(s.path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	c.Assert(reg.Healthy(), ErrorMatches, "catalog file is not published")
+
+	c.Assert(reg.Start(), IsNil)
+	c.Assert(reg.Healthy(), IsNil)
+	catalog := s.readCatalog(c)
+	c.Assert(catalog.App, Equals, "users")
+	c.Assert(catalog.Server.URL, Equals, "http://127.0.0.1:8080")
+	c.Assert(catalog.Frontends, DeepEquals, []Frontend{{Host: "api.example.com", Path: "/users", Methods: []string{"GET"}}})
+
+	// Frontends changed at runtime are published right away.
+	c.Assert(reg.AddFrontend("api.example.com", "/users/{id}", []string{"GET"}, nil), IsNil)
+	c.Assert(reg.RemoveFrontend("api.example.com", "/users", []string{"GET"}), IsNil)
+	c.Assert(s.readCatalog(c).Frontends, DeepEquals, []Frontend{{Host: "api.example.com", Path: "/users/{id}", Methods: []string{"GET"}}})
+
+	reg.Stop()
+	_, err = os.Stat(s.path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	c.Assert(reg.Healthy(), NotNil)
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
+
+func (s *FileSuite) TestFormat(c *C) {
+	reg, err := NewFileWithFormat(s.path, TraefikJSON, "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.AddFrontend("api.example.com", "/users", []string{"GET"}, nil), IsNil)
+	c.Assert(reg.Start(), IsNil)
+	defer reg.Stop()
+
+	data, err := ioutil.ReadFile(s.path)
+	c.Assert(err, IsNil)
+	var config TraefikConfig
+	c.Assert(json.Unmarshal(data, &config), IsNil)
+	c.Assert(config.HTTP.Routers["users-api-example-com-get-users"].Rule, Equals,
+		"Host(`api.example.com`) && Method(`GET`) && Path(`/users`)")
+	c.Assert(config.HTTP.Services["users"].LoadBalancer.Servers, DeepEquals, []TraefikServer{{URL: "http://127.0.0.1:8080"}})
+}
+
+func (s *FileSuite) TestStartFails(c *C) {
+	reg, err := NewFile(filepath.Join(s.dir, "missing", "catalog.json"), "users", "127.0.0.1", 8080)
+	c.Assert(err, IsNil)
+	c.Assert(reg.Start(), ErrorMatches, "failed to create catalog file: .*")
+	c.Assert(reg.Healthy(), NotNil)
+}
+
+func (s *FileSuite) readCatalog(c *C) Catalog {
+	data, err := ioutil.ReadFile(s.path)
+	c.Assert(err, IsNil)
+	var catalog Catalog
+	c.Assert(json.Unmarshal(data, &catalog), IsNil)
+	return catalog
+}
@@ -0,0 +1,19 @@
+package registrar
+
+import (
+	"github.com/mailgun/scroll/vulcand"
+)
+
+// Noop is a registrar that does not publish apps anywhere, for apps that are reached directly, e.g.
+// in development or behind a statically configured load balancer.
+type Noop struct{}
+
+func (Noop) Start() error { return nil }
+func (Noop) Stop()        {}
+
+func (Noop) AddFrontend(host, path string, methods []string, middlewares []vulcand.Middleware) error {
+	return nil
+}
+
+func (Noop) RemoveFrontend(host, path string, methods []string) error { return nil }
+func (Noop) Healthy() error                                           { return nil }
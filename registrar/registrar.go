@@ -0,0 +1,135 @@
+// Package registrar provides the registrars that publish scroll apps for service discovery in
+// environments without vulcand, see scroll.Registrar:
+//
+//  reg, err := registrar.NewConsul(registrar.ConsulConfig{}, "users", "0.0.0.0", 8080)
+//  if err != nil {
+//      return err
+//  }
+//  app, err := scroll.NewAppWithConfig(scroll.AppConfig{
+//      Name:       "users",
+//      ListenIP:   "0.0.0.0",
+//      ListenPort: 8080,
+//      Registrar:  reg,
+//  })
+//
+// The routes of the handlers can be published as the configuration of proxies other than vulcand
+// too, see NewFileWithFormat, TraefikJSON and EnvoyJSON.
+package registrar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mailgun/iptools"
+	"github.com/mailgun/scroll/vulcand"
+)
+
+// Catalog describes an instance of an app and the routes of its handlers.
+type Catalog struct {
+	App       string     `json:"app"`
+	Server    Server     `json:"server"`
+	Frontends []Frontend `json:"frontends"`
+}
+
+// Server is an instance of an app.
+type Server struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Frontend is the route of a handler.
+type Frontend struct {
+	Host        string               `json:"host"`
+	Path        string               `json:"path"`
+	Methods     []string             `json:"methods"`
+	Middlewares []vulcand.Middleware `json:"middlewares,omitempty"`
+}
+
+// frontendSet keeps the frontends of an app by route, in the order they were added.
+type frontendSet struct {
+	mu        sync.Mutex
+	frontends []Frontend
+}
+
+func (s *frontendSet) add(host, path string, methods []string, middlewares []vulcand.Middleware) {
+	fe := Frontend{Host: strings.ToLower(host), Path: path, Methods: normalizeMethods(methods), Middlewares: middlewares}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(fe.Host, fe.Path, fe.Methods); i >= 0 {
+		s.frontends[i] = fe
+		return
+	}
+	s.frontends = append(s.frontends, fe)
+}
+
+func (s *frontendSet) remove(host, path string, methods []string) error {
+	host, methods = strings.ToLower(host), normalizeMethods(methods)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(host, path, methods)
+	if i < 0 {
+		return fmt.Errorf("frontend not found: %v %v%v", methods, host, path)
+	}
+	s.frontends = append(s.frontends[:i:i], s.frontends[i+1:]...)
+	return nil
+}
+
+func (s *frontendSet) list() []Frontend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Frontend{}, s.frontends...)
+}
+
+func (s *frontendSet) index(host, path string, methods []string) int {
+	for i, fe := range s.frontends {
+		if fe.Host == host && fe.Path == path && strings.Join(fe.Methods, ",") == strings.Join(methods, ",") {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeMethods returns a sorted copy of the methods in upper case.
+func normalizeMethods(methods []string) []string {
+	result := make([]string, len(methods))
+	for i, m := range methods {
+		result[i] = strings.ToUpper(m)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// newServer makes the server of an app instance listening on the IP and port. The ID is made of the host
+// name and port, and the URL has the private IP of the host if the app listens on all interfaces.
+func newServer(ip string, port int) (Server, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Server{}, fmt.Errorf("failed to get host name: %v", err)
+	}
+	ip, err = advertisedIP(ip)
+	if err != nil {
+		return Server{}, err
+	}
+	return Server{ID: fmt.Sprintf("%v_%v", hostname, port), URL: fmt.Sprintf("http://%v:%v", ip, port)}, nil
+}
+
+// advertisedIP returns the IP address other hosts can reach an app listening on the IP at.
+func advertisedIP(ip string) (string, error) {
+	if ip != "0.0.0.0" && ip != "" {
+		return ip, nil
+	}
+	privateIPs, err := iptools.GetPrivateHostIPs()
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain host's private IPs: %v", err)
+	}
+	if len(privateIPs) == 0 {
+		return "", errors.New("no host's private IPs are found")
+	}
+	return fmt.Sprintf("%v", privateIPs[0]), nil
+}
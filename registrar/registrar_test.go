@@ -0,0 +1,33 @@
+package registrar
+
+import (
+	"testing"
+
+	"github.com/mailgun/scroll/vulcand"
+	. "gopkg.in/check.v1"
+)
+
+func TestRegistrar(t *testing.T) { TestingT(t) }
+
+type FrontendSetSuite struct{}
+
+var _ = Suite(&FrontendSetSuite{})
+
+func (s *FrontendSetSuite) TestAddRemove(c *C) {
+	var set frontendSet
+	set.add("API.example.com", "/users", []string{"post", "GET"}, nil)
+	set.add("api.example.com", "/users/{id}", []string{"GET"}, nil)
+	c.Assert(set.list(), DeepEquals, []Frontend{
+		{Host: "api.example.com", Path: "/users", Methods: []string{"GET", "POST"}},
+		{Host: "api.example.com", Path: "/users/{id}", Methods: []string{"GET"}},
+	})
+
+	// The same route replaces the frontend in place.
+	set.add("api.example.com", "/users", []string{"GET", "POST"}, []vulcand.Middleware{{ID: "auth", Type: "auth"}})
+	c.Assert(set.list()[0].Middlewares, HasLen, 1)
+	c.Assert(set.list(), HasLen, 2)
+
+	c.Assert(set.remove("api.example.com", "/users", []string{"POST", "GET"}), IsNil)
+	c.Assert(set.list(), DeepEquals, []Frontend{{Host: "api.example.com", Path: "/users/{id}", Methods: []string{"GET"}}})
+	c.Assert(set.remove("api.example.com", "/users", []string{"GET", "POST"}), ErrorMatches, "frontend not found: .*")
+}
@@ -0,0 +1,93 @@
+package registrar
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TraefikConfig is the dynamic configuration of Traefik v2 that routes the frontends of an app instance
+// to it: a router per frontend and a service named after the app.
+type TraefikConfig struct {
+	HTTP TraefikHTTP `json:"http"`
+}
+
+type TraefikHTTP struct {
+	Routers  map[string]TraefikRouter  `json:"routers"`
+	Services map[string]TraefikService `json:"services"`
+}
+
+type TraefikRouter struct {
+	Rule        string   `json:"rule"`
+	Service     string   `json:"service"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+type TraefikService struct {
+	LoadBalancer TraefikLoadBalancer `json:"loadBalancer"`
+}
+
+type TraefikLoadBalancer struct {
+	Servers []TraefikServer `json:"servers"`
+}
+
+type TraefikServer struct {
+	URL string `json:"url"`
+}
+
+// NewTraefikConfig makes the Traefik configuration of the catalog. The rule of a router matches the
+// host, methods and path template of the frontend, e.g.:
+//
+//  Host(`api.example.com`) && Method(`GET`, `POST`) && Path(`/v3/{domain}/events`)
+//
+// Traefik middlewares are referenced by the IDs of the vulcand middlewares of the frontend, in the
+// order of their priorities, so middlewares with the same names have to be defined in Traefik.
+func NewTraefikConfig(catalog Catalog) TraefikConfig {
+	routers := make(map[string]TraefikRouter, len(catalog.Frontends))
+	for _, fe := range catalog.Frontends {
+		router := TraefikRouter{Rule: traefikRule(fe), Service: catalog.App}
+		for _, mw := range fe.Middlewares {
+			router.Middlewares = append(router.Middlewares, mw.ID)
+		}
+		routers[routerName(catalog.App, fe)] = router
+	}
+	return TraefikConfig{HTTP: TraefikHTTP{
+		Routers: routers,
+		Services: map[string]TraefikService{
+			catalog.App: {LoadBalancer: TraefikLoadBalancer{Servers: []TraefikServer{{URL: catalog.Server.URL}}}},
+		},
+	}}
+}
+
+// TraefikJSON is a Format that encodes the catalog as the Traefik configuration, for the Traefik file
+// provider to load. JSON is valid YAML, so the file is read if it has the ".yml" extension.
+//
+// The file provider is the supported way to publish apps to Traefik. The configuration describes a
+// single instance of the app, so it is meant for a Traefik watching the file next to the instance.
+func TraefikJSON(catalog Catalog) ([]byte, error) {
+	return json.MarshalIndent(NewTraefikConfig(catalog), "", "  ")
+}
+
+// traefikRule returns the rule of the router of the frontend. Traefik v2 understands the path templates
+// of gorilla/mux, including the regular expressions of path variables, so paths are used as they are.
+func traefikRule(fe Frontend) string {
+	var matchers []string
+	if fe.Host != "" {
+		matchers = append(matchers, fmt.Sprintf("Host(`%s`)", fe.Host))
+	}
+	if len(fe.Methods) > 0 {
+		matchers = append(matchers, fmt.Sprintf("Method(`%s`)", strings.Join(fe.Methods, "`, `")))
+	}
+	matchers = append(matchers, fmt.Sprintf("Path(`%s`)", fe.Path))
+	return strings.Join(matchers, " && ")
+}
+
+var nonNameChars = regexp.MustCompile("[^a-z0-9]+")
+
+// routerName makes a name of the route of the frontend that is safe to use in router configuration,
+// e.g. "users-api-example-com-get-post-v3-domain-events".
+func routerName(app string, fe Frontend) string {
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s-%s", app, fe.Host, strings.Join(fe.Methods, "-"), fe.Path))
+	return strings.Trim(nonNameChars.ReplaceAllString(name, "-"), "-")
+}
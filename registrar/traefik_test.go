@@ -0,0 +1,49 @@
+package registrar
+
+import (
+	"encoding/json"
+
+	"github.com/mailgun/scroll/vulcand"
+	. "gopkg.in/check.v1"
+)
+
+type TraefikSuite struct{}
+
+var _ = Suite(&TraefikSuite{})
+
+func (s *TraefikSuite) TestConfig(c *C) {
+	config := NewTraefikConfig(testCatalog())
+	c.Assert(config, DeepEquals, TraefikConfig{HTTP: TraefikHTTP{
+		Routers: map[string]TraefikRouter{
+			"users-api-example-com-get-post-v3-domain-users": {
+				Rule:        "Host(`api.example.com`) && Method(`GET`, `POST`) && Path(`/v3/{domain}/users`)",
+				Service:     "users",
+				Middlewares: []string{"auth", "ratelimit"},
+			},
+			"users-get-users-id-0-9": {
+				Rule:    "Method(`GET`) && Path(`/users/{id:[0-9]+}`)",
+				Service: "users",
+			},
+		},
+		Services: map[string]TraefikService{
+			"users": {LoadBalancer: TraefikLoadBalancer{Servers: []TraefikServer{{URL: "http://10.0.0.1:8080"}}}},
+		},
+	}})
+
+	data, err := TraefikJSON(testCatalog())
+	c.Assert(err, IsNil)
+	var decoded TraefikConfig
+	c.Assert(json.Unmarshal(data, &decoded), IsNil)
+	c.Assert(decoded, DeepEquals, config)
+}
+
+// testCatalog returns the catalog of an instance with a public frontend and a frontend without a host.
+func testCatalog() Catalog {
+	var set frontendSet
+	set.add("api.example.com", "/v3/{domain}/users", []string{"POST", "GET"}, []vulcand.Middleware{
+		{ID: "auth", Type: "auth"},
+		{ID: "ratelimit", Type: "ratelimit"},
+	})
+	set.add("", "/users/{id:[0-9]+}", []string{"GET"}, nil)
+	return Catalog{App: "users", Server: Server{ID: "host_8080", URL: "http://10.0.0.1:8080"}, Frontends: set.list()}
+}
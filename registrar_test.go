@@ -0,0 +1,197 @@
+package scroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+
+	"github.com/mailgun/scroll/vulcand"
+	. "gopkg.in/check.v1"
+)
+
+type RegistrarSuite struct{}
+
+var _ = Suite(&RegistrarSuite{})
+
+func (s *RegistrarSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *RegistrarSuite) TestFrontends(c *C) {
+	reg := &fakeRegistrar{}
+	app, err := NewAppWithConfig(AppConfig{Name: "test", PublicAPIHost: "api.example.com", Registrar: reg})
+	c.Assert(err, IsNil)
+
+	middlewares := []vulcand.Middleware{{Type: "ratelimit", ID: "rl"}}
+	c.Assert(app.AddHandler(Spec{
+		Scope:       ScopePublic,
+		Methods:     []string{"GET"},
+		Paths:       []string{"/users", "/v3/users"},
+		Handler:     func(http.ResponseWriter, *http.Request, map[string]string) (interface{}, error) { return nil, nil },
+		Middlewares: middlewares,
+	}), IsNil)
+	c.Assert(app.RemoveHandler(Spec{Methods: []string{"GET"}, Paths: []string{"/users"}}), IsNil)
+	c.Assert(reg.calls(), DeepEquals, []string{
+		"add [GET] api.example.com/users 1",
+		"add [GET] api.example.com/v3/users 1",
+		"remove [GET] api.example.com/users",
+	})
+
+	reg.err = errors.New("catalog is read-only")
+	c.Assert(app.AddHandler(Spec{
+		Scope:   ScopePublic,
+		Methods: []string{"POST"},
+		Paths:   []string{"/users"},
+		Handler: func(http.ResponseWriter, *http.Request, map[string]string) (interface{}, error) { return nil, nil },
+	}), ErrorMatches, "catalog is read-only")
+}
+
+// A handler which frontends fail to be published is not served and can be added again, and a failure to
+// withdraw one frontend of a removed handler does not keep the others published.
+func (s *RegistrarSuite) TestFrontendFailures(c *C) {
+	reg := &fakeRegistrar{failPath: "/v3/users"}
+	app, err := NewAppWithConfig(AppConfig{Name: "test", PublicAPIHost: "api.example.com", Registrar: reg})
+	c.Assert(err, IsNil)
+	spec := Spec{
+		Scope:   ScopePublic,
+		Methods: []string{"GET"},
+		Paths:   []string{"/users", "/v3/users"},
+		Handler: func(http.ResponseWriter, *http.Request, map[string]string) (interface{}, error) { return nil, nil },
+	}
+
+	c.Assert(app.AddHandler(spec), ErrorMatches, "failed to publish /v3/users")
+	c.Assert(reg.calls(), DeepEquals, []string{
+		"add [GET] api.example.com/users 0",
+		"add [GET] api.example.com/v3/users 0 failed",
+		"remove [GET] api.example.com/users",
+		"remove [GET] api.example.com/v3/users failed",
+	})
+	w := httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	reg.failPath = ""
+	c.Assert(app.AddHandler(spec), IsNil)
+	w = httptest.NewRecorder()
+	app.GetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	reg.failPath = "/users"
+	reg.log = nil
+	c.Assert(app.RemoveHandler(spec), ErrorMatches, "failed to publish /users")
+	c.Assert(reg.calls(), DeepEquals, []string{
+		"remove [GET] api.example.com/users failed",
+		"remove [GET] api.example.com/v3/users",
+	})
+}
+
+func (s *RegistrarSuite) TestRun(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	port := l.Addr().(*net.TCPAddr).Port
+	c.Assert(l.Close(), IsNil)
+
+	reg := &fakeRegistrar{}
+	app, err := NewAppWithConfig(AppConfig{Name: "test", ListenIP: "127.0.0.1", ListenPort: port, Registrar: reg})
+	c.Assert(err, IsNil)
+
+	// The app is not ready until it is registered.
+	report, err := app.CheckHealth(context.Background(), HealthReadiness)
+	c.Assert(err, IsNil)
+	c.Assert(report.Checks[HealthCheckRegistrar].Error, Equals, "not registered")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.OnStart(func(context.Context) error {
+		go func() {
+			(&LifecycleSuite{}).waitServing(app)
+			report, err := app.CheckHealth(context.Background(), HealthReadiness)
+			c.Check(err, IsNil)
+			c.Check(report.Status, Equals, HealthOK)
+			cancel()
+		}()
+		return nil
+	})
+	c.Assert(app.RunContext(ctx), Equals, http.ErrServerClosed)
+	c.Assert(reg.calls(), DeepEquals, []string{"start", "stop"})
+}
+
+func (s *RegistrarSuite) TestStartFails(c *C) {
+	reg := &fakeRegistrar{err: errors.New("agent is down")}
+	app, err := NewAppWithConfig(AppConfig{Name: "test", ListenIP: "127.0.0.1", Registrar: reg})
+	c.Assert(err, IsNil)
+	c.Assert(app.RunContext(context.Background()), ErrorMatches, `failed to start registrar: err=\(agent is down\)`)
+}
+
+// fakeRegistrar records the calls made to it and fails them with err if set. Changes of the frontends
+// with failPath fail too.
+type fakeRegistrar struct {
+	mu       sync.Mutex
+	log      []string
+	running  bool
+	err      error
+	failPath string
+}
+
+func (r *fakeRegistrar) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.log = append(r.log, "start")
+	r.running = true
+	return nil
+}
+
+func (r *fakeRegistrar) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = append(r.log, "stop")
+	r.running = false
+}
+
+func (r *fakeRegistrar) AddFrontend(host, path string, methods []string, middlewares []vulcand.Middleware) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	return r.record(path, "add %v %v%v %v", methods, host, path, len(middlewares))
+}
+
+func (r *fakeRegistrar) RemoveFrontend(host, path string, methods []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record(path, "remove %v %v%v", methods, host, path)
+}
+
+// record logs a change of the frontend with the path, and fails it if the path is failPath.
+func (r *fakeRegistrar) record(path, format string, args ...interface{}) error {
+	call := fmt.Sprintf(format, args...)
+	if path == r.failPath {
+		r.log = append(r.log, call+" failed")
+		return fmt.Errorf("failed to publish %v", path)
+	}
+	r.log = append(r.log, call)
+	return nil
+}
+
+func (r *fakeRegistrar) Healthy() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.running {
+		return errors.New("not registered")
+	}
+	return nil
+}
+
+func (r *fakeRegistrar) calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.log...)
+}
@@ -0,0 +1,87 @@
+package scroll
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header used to receive request IDs from clients and upstream services and to send them back.
+const RequestIDHeader = "X-Request-ID"
+
+// Max length of a request ID accepted from a client, longer ones are replaced with generated IDs.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request being served, so that handlers can log it or pass it
+// on to the services they call, e.g.:
+//
+//  req.Header.Set(scroll.RequestIDHeader, scroll.RequestID(r))
+//
+// The ID is taken from the X-Request-ID header of the request if it has one, or generated otherwise.
+// Returns an empty string if the request was not served by a scroll handler.
+func RequestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDHandler wraps the handler so that requests have IDs in their context before reaching
+// the handler and its middlewares.
+func requestIDHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, withRequestID(w, r))
+	})
+}
+
+// withRequestID returns the request with its ID in the context and sets the ID header of the response.
+// It does nothing if the request already has an ID.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if RequestID(r) != "" {
+		return r
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// validRequestID checks that the request ID received from a client is safe to log and send back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// addRequestID adds the ID of the request being replied to the error response, if the response is
+// an object and the ID is known.
+func addRequestID(w http.ResponseWriter, response interface{}) {
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" {
+		return
+	}
+	switch response := response.(type) {
+	case Response:
+		response["request_id"] = id
+	case Problem:
+		response["request_id"] = id
+	}
+}
@@ -0,0 +1,80 @@
+package scroll
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type RequestIDSuite struct{}
+
+var _ = Suite(&RequestIDSuite{})
+
+func (s *RequestIDSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *RequestIDSuite) TestRequestID(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	var seen, middlewareSeen string
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewareSeen = RequestID(r)
+			next.ServeHTTP(w, r)
+		})
+	})
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/users/{id}"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			seen = RequestID(r)
+			return nil, NotFoundError{"no such user"}
+		},
+	}), IsNil)
+
+	for i, tc := range []struct {
+		header    string
+		generated bool
+	}{
+		{header: "abc-123"},
+		{header: "", generated: true},
+		{header: "has spaces", generated: true},
+		{header: strings.Repeat("x", maxRequestIDLength+1), generated: true},
+	} {
+		c.Logf("Test case #%d", i)
+		r := httptest.NewRequest("GET", "/users/1", nil)
+		if tc.header != "" {
+			r.Header.Set(RequestIDHeader, tc.header)
+		}
+		w := httptest.NewRecorder()
+		app.GetHandler().ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if tc.generated {
+			c.Assert(id, Matches, "[0-9a-f]{32}")
+		} else {
+			c.Assert(id, Equals, tc.header)
+		}
+		c.Assert(seen, Equals, id)
+		c.Assert(middlewareSeen, Equals, id)
+		c.Assert(w.Body.String(), Equals, `{"message":"no such user","request_id":"`+id+`"}`)
+	}
+}
+
+func (s *RequestIDSuite) TestReplyError(c *C) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	r = withRequestID(w, r)
+	c.Assert(RequestID(r), Equals, "abc")
+
+	ReplyError(w, ConflictError{"already exists"})
+	c.Assert(w.Body.String(), Equals, `{"message":"already exists","request_id":"abc"}`)
+
+	// Requests not served by scroll handlers have no ID.
+	c.Assert(RequestID(httptest.NewRequest("GET", "/", nil)), Equals, "")
+}
@@ -0,0 +1,97 @@
+package scroll
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Metric ID of the requests that are not routed by mux and have no Spec.MetricName.
+const unroutedMetricID = "unrouted"
+
+// routeTemplate returns the path template of the route that matched the request with the variable
+// patterns removed, e.g. "/users/{id}" for "/users/{id:[0-9]+}", or an empty string if the request
+// was not routed by mux.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return stripPatterns(template)
+}
+
+// RouteKey returns a stable key identifying the route that matched the request: its method and path
+// template, e.g. "GET /v3/{domain}/events". Unlike the request path, it does not depend on
+// the values of the path variables, so it is suitable for grouping requests in logs and metrics.
+// Returns an empty string if the request was not routed by mux.
+func RouteKey(r *http.Request) string {
+	template := routeTemplate(r)
+	if template == "" {
+		return ""
+	}
+	return r.Method + " " + template
+}
+
+// metricID returns the ID the requests served by a handler made for the spec are tracked with:
+// Spec.MetricName, or the route key converted to a metric name if it is not provided, e.g.
+// "get_v3_domain_events" for "GET /v3/{domain}/events".
+func metricID(spec Spec, r *http.Request) string {
+	if spec.MetricName != "" {
+		return spec.MetricName
+	}
+	key := RouteKey(r)
+	if key == "" {
+		return unroutedMetricID
+	}
+
+	var buf bytes.Buffer
+	separate := false
+	for _, c := range strings.ToLower(key) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if separate && buf.Len() > 0 {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(c)
+			separate = false
+		} else {
+			separate = true
+		}
+	}
+	return buf.String()
+}
+
+// stripPatterns removes the regular expressions of the variables from the path template, e.g.
+// "/users/{id:[0-9]+}" becomes "/users/{id}".
+func stripPatterns(template string) string {
+	var buf bytes.Buffer
+	depth, skip := 0, false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				skip = false
+				buf.WriteRune(c)
+				continue
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				buf.WriteRune(c)
+				continue
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+		if depth == 0 || !skip {
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
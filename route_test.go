@@ -0,0 +1,51 @@
+package scroll
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type RouteSuite struct{}
+
+var _ = Suite(&RouteSuite{})
+
+func (s *RouteSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *RouteSuite) TestRouteKey(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+
+	var routed *http.Request
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		routed = r
+		return Response{}, nil
+	}
+	c.Assert(app.AddHandler(Spec{Methods: []string{"GET"}, Paths: []string{"/v3/{domain}/events"}, Handler: handler}), IsNil)
+	c.Assert(app.AddHandler(Spec{Methods: []string{"DELETE"}, Paths: []string{"/users/{id:[0-9]{1,9}}"}, Handler: handler}), IsNil)
+
+	for i, tc := range []struct {
+		method string
+		path   string
+		key    string
+		metric string
+	}{
+		{"GET", "/v3/example.com/events", "GET /v3/{domain}/events", "get_v3_domain_events"},
+		{"DELETE", "/users/42", "DELETE /users/{id}", "delete_users_id"},
+	} {
+		c.Logf("Test case #%d", i)
+		app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+		c.Assert(RouteKey(routed), Equals, tc.key)
+		c.Assert(metricID(Spec{}, routed), Equals, tc.metric)
+		c.Assert(metricID(Spec{MetricName: "events"}, routed), Equals, "events")
+	}
+
+	// Requests that are not routed by mux have no route key.
+	r := httptest.NewRequest("GET", "/v3/example.com/events", nil)
+	c.Assert(RouteKey(r), Equals, "")
+	c.Assert(metricID(Spec{}, r), Equals, "unrouted")
+}
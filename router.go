@@ -0,0 +1,141 @@
+package scroll
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// appRoute is a path of a handler added to the app.
+type appRoute struct {
+	methods []string
+	path    string
+	headers []string
+	scope   Scope
+	handler http.Handler
+	removed int32
+}
+
+// active is a mux matcher that stops the route from matching requests once the handler is removed.
+func (r *appRoute) active(*http.Request, *mux.RouteMatch) bool {
+	return atomic.LoadInt32(&r.removed) == 0
+}
+
+// RemoveHandler removes the handler with the methods and paths of the spec, and withdraws its frontends
+// from the registrar of the app if any. The handler stops serving requests right away, even if the app
+// is running.
+//
+// Handlers can be added and removed while the app is running, unless the app is configured with
+// AppConfig.Router, in which case the router is not replaced and adding handlers is not safe while
+// it serves requests.
+func (app *App) RemoveHandler(spec Spec) error {
+	app.routesMu.Lock()
+	var removed []*appRoute
+	routes := app.routes[:0:0]
+	for _, route := range app.routes {
+		if containsString(spec.Paths, route.path) && sameMethods(route.methods, spec.Methods) {
+			atomic.StoreInt32(&route.removed, 1)
+			removed = append(removed, route)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	app.routes = routes
+	app.routesMu.Unlock()
+
+	if len(removed) == 0 {
+		return fmt.Errorf("no handler registered for %v %v", spec.Methods, spec.Paths)
+	}
+	if app.registrar == nil {
+		return nil
+	}
+	// A failure to withdraw one frontend does not stop the others from being withdrawn.
+	var errs []error
+	for _, route := range removed {
+		errs = append(errs, app.deregisterFrontend(route.methods, route.path, route.scope))
+	}
+	return joinErrors(errs)
+}
+
+// addRoute makes the router of the app serve the route. Once the router has been handed out by
+// GetHandler it may be serving requests, so a new router is made and swapped in instead of changing
+// the router in place.
+func (app *App) addRoute(route *appRoute) {
+	app.routesMu.Lock()
+	defer app.routesMu.Unlock()
+	app.routes = append(app.routes, route)
+	app.updateRouter(func(router *mux.Router) { handleRoute(router, route) })
+}
+
+// updateRouter applies the change to the router of the app, or to a new router with all the routes
+// of the app if the router may be serving requests. Must be called with routesMu locked.
+func (app *App) updateRouter(change func(router *mux.Router)) {
+	if !app.published || app.Config.Router != nil {
+		change(app.router)
+		return
+	}
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.NotFoundHandler = app.notFound
+	app.addBuiltinRoutes(router)
+	for _, route := range app.routes {
+		handleRoute(router, route)
+	}
+	change(router)
+	app.router = router
+	app.current.Store(router)
+}
+
+// addBuiltinRoutes adds the routes that every app serves.
+func (app *App) addBuiltinRoutes(router *mux.Router) {
+	router.HandleFunc("/_ping", handlePing).Methods("GET")
+	router.HandleFunc("/_health/live", app.healthHandler(HealthLiveness)).Methods("GET")
+	router.HandleFunc("/_health/ready", app.healthHandler(HealthReadiness)).Methods("GET")
+	if handler, ok := app.Config.Stats.(http.Handler); ok {
+		router.Handle("/_metrics", handler).Methods("GET")
+	}
+}
+
+// serveHTTP serves the request with the current router of the app.
+func (app *App) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	app.current.Load().(*mux.Router).ServeHTTP(w, r)
+}
+
+func handleRoute(router *mux.Router, route *appRoute) {
+	// Methods are upper-cased in place, which would race with the previous router still serving requests.
+	methods := append([]string(nil), route.methods...)
+	r := router.Handle(route.path, route.handler).Methods(methods...).MatcherFunc(route.active)
+	if len(route.headers) != 0 {
+		r.Headers(route.headers...)
+	}
+}
+
+// sameMethods tells whether the lists have the same methods regardless of their case and order.
+func sameMethods(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalize := func(methods []string) string {
+		upper := make([]string, len(methods))
+		for i, m := range methods {
+			upper[i] = strings.ToUpper(m)
+		}
+		sort.Strings(upper)
+		return strings.Join(upper, ",")
+	}
+	return normalize(a) == normalize(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
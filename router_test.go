@@ -0,0 +1,91 @@
+package scroll
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+type RouterSuite struct{}
+
+var _ = Suite(&RouterSuite{})
+
+func (s *RouterSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *RouterSuite) TestRuntimeHandlers(c *C) {
+	for i, router := range []*mux.Router{nil, mux.NewRouter()} {
+		c.Logf("Test case #%d", i)
+		app, err := NewAppWithConfig(AppConfig{Name: "test", Router: router})
+		c.Assert(err, IsNil)
+		handler := app.GetHandler()
+
+		c.Assert(app.AddHandler(s.spec("v1")), IsNil)
+		c.Assert(s.get(handler, "/users"), Equals, `{"version":"v1"}`)
+
+		c.Assert(app.RemoveHandler(Spec{Methods: []string{"get"}, Paths: []string{"/users"}}), IsNil)
+		c.Assert(s.get(handler, "/users"), Equals, "404 page not found\n")
+		c.Assert(app.RemoveHandler(Spec{Methods: []string{"GET"}, Paths: []string{"/users"}}), ErrorMatches,
+			`no handler registered for \[GET\] \[/users\]`)
+
+		c.Assert(app.AddHandler(s.spec("v2")), IsNil)
+		c.Assert(s.get(handler, "/users"), Equals, `{"version":"v2"}`)
+		c.Assert(s.get(handler, "/_ping"), Equals, "pong")
+	}
+}
+
+func (s *RouterSuite) TestConcurrentChanges(c *C) {
+	app, err := NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(app.AddHandler(s.spec("v1")), IsNil)
+	handler := app.GetHandler()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c.Check(s.get(handler, "/users"), Equals, `{"version":"v1"}`)
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		path := fmt.Sprintf("/items/%d", i)
+		spec := Spec{Methods: []string{"GET"}, Paths: []string{path}, RawHandler: func(w http.ResponseWriter, r *http.Request) {}}
+		c.Assert(app.AddHandler(spec), IsNil)
+		if i%2 == 0 {
+			c.Assert(app.RemoveHandler(spec), IsNil)
+		}
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/items/48", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/items/49", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
+
+func (s *RouterSuite) spec(version string) Spec {
+	return Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/users"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return Response{"version": version}, nil
+		},
+	}
+}
+
+func (s *RouterSuite) get(handler http.Handler, path string) string {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Body.String()
+}
@@ -8,36 +8,150 @@ import (
 	"github.com/mailgun/metrics"
 )
 
+// StatsBackend receives the stats of the requests served by an app's handlers, e.g. to emit them
+// to statsd or expose them to Prometheus.
+type StatsBackend interface {
+	// TrackRequest is called when a request has been served.
+	TrackRequest(stats RequestStats)
+
+	// TrackInFlight is called with 1 when a handler starts serving a request and with -1 when
+	// it is done. Only the route of the stats is known.
+	TrackInFlight(stats RequestStats, delta int)
+
+	// TrackPanic is called when a handler panics.
+	TrackPanic(stats RequestStats)
+
+	// TrackBatch is called when a batch handler has processed a batch of the size, failed
+	// is the number of items that could not be processed.
+	TrackBatch(stats RequestStats, size, failed int)
+}
+
+// RequestStats describes a request for stats backends.
+type RequestStats struct {
+	// Metric ID of the handler, see Spec.MetricName.
+	Metric string
+
+	// Method and path template of the matched route, e.g. "/v3/{domain}/events". The template
+	// is empty if the request was not routed by mux.
+	Method string
+	Route  string
+
+	// Status code the request was replied with and the time it took to serve it.
+	Status   int
+	Duration time.Duration
+
+	// Whether the status code means that the request failed, see AppConfig.SuccessStatus.
+	Failed bool
+
+	// Number of bytes of the request body read by the handler and of the response body written.
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// StatusClass returns the class of the status code, e.g. "2xx".
+func (s RequestStats) StatusClass() string {
+	return fmt.Sprintf("%dxx", s.Status/100)
+}
+
+// DefaultSuccessStatus considers requests replied with informational, successful and redirection
+// status codes succeeded.
+func DefaultSuccessStatus(status int) bool {
+	return status < http.StatusBadRequest
+}
+
+// appStats passes the stats of the requests to all the stats backends of the app.
 type appStats struct {
-	c metrics.Client
+	backends []StatsBackend
+	success  func(status int) bool
+}
+
+func newAppStats(client metrics.Client, backend StatsBackend, success func(status int) bool) *appStats {
+	if success == nil {
+		success = DefaultSuccessStatus
+	}
+	s := &appStats{success: success}
+	if client != nil {
+		s.backends = append(s.backends, &statsdBackend{c: client})
+	}
+	if backend != nil {
+		s.backends = append(s.backends, backend)
+	}
+	return s
+}
+
+// requestStats returns the stats of the request served by a handler made for the spec, with only
+// the route known.
+func requestStats(spec Spec, r *http.Request) RequestStats {
+	return RequestStats{Metric: metricID(spec, r), Method: r.Method, Route: routeTemplate(r)}
+}
+
+func (s *appStats) TrackRequest(stats RequestStats, status int, time time.Duration, requestBytes, responseBytes int64) {
+	stats.Status, stats.Duration = status, time
+	stats.Failed = !s.success(status)
+	stats.RequestBytes, stats.ResponseBytes = requestBytes, responseBytes
+	for _, b := range s.backends {
+		b.TrackRequest(stats)
+	}
 }
 
-func newAppStats(client metrics.Client) *appStats {
-	return &appStats{
-		c: client,
+func (s *appStats) TrackInFlight(stats RequestStats, delta int) {
+	for _, b := range s.backends {
+		b.TrackInFlight(stats, delta)
 	}
 }
 
-func (s *appStats) TrackRequest(metricID string, status int, time time.Duration) {
-	if s.c == nil {
-		return
+func (s *appStats) TrackPanic(stats RequestStats) {
+	for _, b := range s.backends {
+		b.TrackPanic(stats)
 	}
+}
+
+func (s *appStats) TrackBatch(stats RequestStats, size, failed int) {
+	for _, b := range s.backends {
+		b.TrackBatch(stats, size, failed)
+	}
+}
 
-	s.TrackRequestTime(metricID, time)
-	s.TrackTotalRequests(metricID)
-	if status != http.StatusOK {
-		s.TrackFailedRequests(metricID, status)
+// statsdBackend emits the stats with the metrics client of the app.
+type statsdBackend struct {
+	c metrics.Client
+}
+
+func (s *statsdBackend) TrackRequest(stats RequestStats) {
+	s.TrackRequestTime(stats.Metric, stats.Duration)
+	s.TrackTotalRequests(stats.Metric)
+	s.c.Inc(fmt.Sprintf("api.%v.count.%v", stats.Metric, stats.StatusClass()), 1, 1.0)
+	if stats.Failed {
+		s.TrackFailedRequests(stats.Metric, stats.Status)
 	}
+	s.c.Timing(fmt.Sprintf("api.%v.bytes.request", stats.Metric), stats.RequestBytes, 1.0)
+	s.c.Timing(fmt.Sprintf("api.%v.bytes.response", stats.Metric), stats.ResponseBytes, 1.0)
 }
 
-func (s *appStats) TrackRequestTime(metricID string, time time.Duration) {
+func (s *statsdBackend) TrackRequestTime(metricID string, time time.Duration) {
 	s.c.TimingMs(fmt.Sprintf("api.%v.time", metricID), time, 1.0)
 }
 
-func (s *appStats) TrackTotalRequests(metricID string) {
+func (s *statsdBackend) TrackTotalRequests(metricID string) {
 	s.c.Inc(fmt.Sprintf("api.%v.count.total", metricID), 1, 1.0)
 }
 
-func (s *appStats) TrackFailedRequests(metricID string, status int) {
+func (s *statsdBackend) TrackFailedRequests(metricID string, status int) {
 	s.c.Inc(fmt.Sprintf("api.%v.count.failed.%v", metricID, status), 1, 1.0)
 }
+
+func (s *statsdBackend) TrackInFlight(stats RequestStats, delta int) {
+	s.c.GaugeDelta(fmt.Sprintf("api.%v.in_flight", stats.Metric), int64(delta), 1.0)
+}
+
+func (s *statsdBackend) TrackPanic(stats RequestStats) {
+	s.c.Inc(fmt.Sprintf("api.%v.panics", stats.Metric), 1, 1.0)
+}
+
+func (s *statsdBackend) TrackBatch(stats RequestStats, size, failed int) {
+	s.c.Inc(fmt.Sprintf("api.%v.batch.count", stats.Metric), 1, 1.0)
+	s.c.Inc(fmt.Sprintf("api.%v.batch.items.total", stats.Metric), int64(size), 1.0)
+	if failed > 0 {
+		s.c.Inc(fmt.Sprintf("api.%v.batch.items.failed", stats.Metric), int64(failed), 1.0)
+	}
+}
@@ -0,0 +1,221 @@
+package scroll
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of items written by a Stream between flushes unless Stream.FlushEvery is provided.
+	DefaultStreamFlushEvery = 100
+
+	// Max time a Stream holds written items before flushing unless Stream.FlushInterval is provided.
+	DefaultStreamFlushInterval = time.Second
+)
+
+// StreamFormat defines how the items of a Stream are written.
+type StreamFormat int
+
+const (
+	// StreamJSONArray writes the items as elements of a JSON array.
+	StreamJSONArray StreamFormat = iota
+
+	// StreamNDJSON writes the items as newline delimited JSON, one item per line.
+	StreamNDJSON
+)
+
+// StreamIterator yields the items of a Stream.
+type StreamIterator interface {
+	// Next returns the next item, or false if there are no more items.
+	Next() (item interface{}, ok bool, err error)
+}
+
+// StreamIteratorFunc is an adapter to use ordinary functions as a StreamIterator.
+type StreamIteratorFunc func() (interface{}, bool, error)
+
+func (f StreamIteratorFunc) Next() (interface{}, bool, error) {
+	return f()
+}
+
+// StreamChan makes a StreamIterator that yields items received from the channel until it is closed.
+// If an error is received, the stream is terminated with it.
+//
+// Whatever sends to the channel should give up when the request context is done, because
+// the stream stops receiving if the client goes away.
+func StreamChan(ch <-chan interface{}) StreamIterator {
+	return StreamIteratorFunc(func() (interface{}, bool, error) {
+		item, ok := <-ch
+		if err, isErr := item.(error); isErr {
+			return nil, false, err
+		}
+		return item, ok, nil
+	})
+}
+
+// Stream is a response that handlers can return to write many items without holding them
+// all in memory, e.g.:
+//
+//  return scroll.NewStream(scroll.StreamNDJSON, scroll.StreamChan(events)), nil
+//
+// Items are encoded to JSON one by one as they are yielded, and the response is flushed
+// to the client periodically. If the iterator fails before yielding the first item, the error
+// is replied as if it was returned by the handler. Once items have been written the status
+// can not be changed anymore, so a failure just ends the response.
+type Stream struct {
+	Format StreamFormat
+	Items  StreamIterator
+
+	// Flush the response after this many items, DefaultStreamFlushEvery if not specified.
+	FlushEvery int
+
+	// Flush the response if items have been held longer than this, DefaultStreamFlushInterval
+	// if not specified.
+	FlushInterval time.Duration
+
+	first     interface{}
+	haveFirst bool
+}
+
+// NewStream creates a stream of the items in the specified format.
+func NewStream(format StreamFormat, items StreamIterator) *Stream {
+	return &Stream{Format: format, Items: items}
+}
+
+// ContentType returns the Content-Type header value of the stream response.
+func (s *Stream) ContentType() string {
+	if s.Format == StreamNDJSON {
+		return MediaTypeNDJSON
+	}
+	return "application/json; charset=utf-8"
+}
+
+// mediaType returns the media type of the stream response, for it to be checked against the Accept
+// header of the request. Streams are written in their own format rather than by the negotiated encoder.
+func (s *Stream) mediaType() string {
+	if s.Format == StreamNDJSON {
+		return MediaTypeNDJSON
+	}
+	return MediaTypeJSON
+}
+
+// prepare fetches the first item, so that a failing iterator can be replied with a proper error.
+func (s *Stream) prepare() error {
+	item, ok, err := s.Items.Next()
+	if err != nil {
+		return err
+	}
+	s.first, s.haveFirst = item, ok
+	return nil
+}
+
+// writeTo writes the stream items to the response with the status code. Returns the error that
+// terminated the stream, if any. Responses with a status code that does not allow a body, e.g. 204,
+// are written without the items.
+//
+// Written items are flushed every FlushEvery items, and by a ticker every FlushInterval, so that
+// they are not held while the iterator blocks waiting for more items.
+func (s *Stream) writeTo(w http.ResponseWriter, status int) error {
+	if !bodyAllowed(status) {
+		w.WriteHeader(status)
+		return nil
+	}
+	flushEvery := s.FlushEvery
+	if flushEvery <= 0 {
+		flushEvery = DefaultStreamFlushEvery
+	}
+	flushInterval := s.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = DefaultStreamFlushInterval
+	}
+
+	// The ticker flushes concurrently with the writes, so both are done with the mutex held.
+	var mu sync.Mutex
+	var unflushed bool
+	pending := 0
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil && unflushed {
+			flusher.Flush()
+		}
+		unflushed, pending = false, 0
+	}
+	// write writes the chunks making up the number of items, and flushes if enough items are pending.
+	write := func(items int, chunks ...[]byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, chunk := range chunks {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+		unflushed = true
+		pending += items
+		if pending >= flushEvery {
+			flush()
+		}
+		return nil
+	}
+
+	setContentType(w, s.ContentType())
+	w.WriteHeader(status)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				flush()
+				mu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+	// The ticker must be stopped before returning, as the response can not be used afterwards.
+	defer wg.Wait()
+	defer close(done)
+	defer func() {
+		mu.Lock()
+		flush()
+		mu.Unlock()
+	}()
+
+	// JSON arrays separate items with commas while NDJSON terminates each item with a newline.
+	var prefix, separator, terminator, suffix []byte
+	if s.Format == StreamNDJSON {
+		terminator = []byte("\n")
+	} else {
+		prefix, separator, suffix = []byte("["), []byte(","), []byte("]")
+	}
+	if err := write(0, prefix); err != nil {
+		return err
+	}
+
+	item, ok := s.first, s.haveFirst
+	for i := 0; ok; i++ {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			err = write(1, data, terminator)
+		} else {
+			err = write(1, separator, data, terminator)
+		}
+		if err != nil {
+			return err
+		}
+		if item, ok, err = s.Items.Next(); err != nil {
+			return err
+		}
+	}
+	return write(0, suffix)
+}
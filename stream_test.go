@@ -0,0 +1,175 @@
+package scroll
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type StreamSuite struct {
+	app *App
+}
+
+var _ = Suite(&StreamSuite{})
+
+func (s *StreamSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+	var err error
+	s.app, err = NewAppWithConfig(AppConfig{Name: "test"})
+	c.Assert(err, IsNil)
+}
+
+func (s *StreamSuite) serve(stream *Stream) *httptest.ResponseRecorder {
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return stream, nil
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/events", nil)
+	r.Header.Set(RequestIDHeader, "test")
+	MakeHandler(s.app, fn, Spec{})(w, r)
+	return w
+}
+
+func sliceIterator(items ...interface{}) StreamIterator {
+	return StreamIteratorFunc(func() (interface{}, bool, error) {
+		if len(items) == 0 {
+			return nil, false, nil
+		}
+		item := items[0]
+		items = items[1:]
+		if err, ok := item.(error); ok {
+			return nil, false, err
+		}
+		return item, true, nil
+	})
+}
+
+func (s *StreamSuite) TestJSONArray(c *C) {
+	w := s.serve(NewStream(StreamJSONArray, sliceIterator(Response{"id": 1}, Response{"id": 2}, "three")))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json; charset=utf-8")
+	c.Assert(w.Header().Get("Vary"), Equals, "Accept")
+	c.Assert(w.Body.String(), Equals, `[{"id":1},{"id":2},"three"]`)
+
+	w = s.serve(NewStream(StreamJSONArray, sliceIterator()))
+	c.Assert(w.Body.String(), Equals, `[]`)
+}
+
+func (s *StreamSuite) TestNDJSON(c *C) {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 3; i++ {
+			ch <- Response{"id": i}
+		}
+	}()
+	w := s.serve(NewStream(StreamNDJSON, StreamChan(ch)))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/x-ndjson")
+	c.Assert(w.Body.String(), Equals, "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n")
+
+	w = s.serve(NewStream(StreamNDJSON, sliceIterator()))
+	c.Assert(w.Body.String(), Equals, "")
+}
+
+// Streams are written in their own format, so they are served to the requests accepting it only.
+func (s *StreamSuite) TestAccept(c *C) {
+	for i, tc := range []struct {
+		format      StreamFormat
+		accept      string
+		status      int
+		contentType string
+	}{
+		{StreamNDJSON, "application/x-ndjson", http.StatusOK, "application/x-ndjson"},
+		{StreamNDJSON, "application/json, application/x-ndjson;q=0.5", http.StatusOK, "application/x-ndjson"},
+		{StreamNDJSON, "text/csv", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{StreamNDJSON, "application/json", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{StreamJSONArray, "application/json; pretty=true", http.StatusOK, "application/json; charset=utf-8"},
+		{StreamJSONArray, "*/*, application/json;q=0", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+	} {
+		c.Logf("Test case #%d", i)
+		fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return NewStream(tc.format, sliceIterator(1)), nil
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/events", nil)
+		r.Header.Set("Accept", tc.accept)
+		MakeHandler(s.app, fn, Spec{})(w, r)
+		c.Assert(w.Code, Equals, tc.status)
+		c.Assert(w.Header().Get("Content-Type"), Equals, tc.contentType)
+	}
+}
+
+func (s *StreamSuite) TestFlush(c *C) {
+	stream := NewStream(StreamNDJSON, sliceIterator(1, 2, 3, 4, 5))
+	stream.FlushEvery = 2
+	w := s.serve(stream)
+	c.Assert(w.Flushed, Equals, true)
+	c.Assert(w.Body.String(), Equals, "1\n2\n3\n4\n5\n")
+
+	stream = NewStream(StreamNDJSON, sliceIterator(1, 2))
+	stream.FlushEvery = 100
+	stream.FlushInterval = time.Nanosecond
+	w = httptest.NewRecorder()
+	c.Assert(stream.prepare(), IsNil)
+	c.Assert(stream.writeTo(w, http.StatusOK), IsNil)
+	c.Assert(w.Flushed, Equals, true)
+}
+
+// Items written before the iterator blocks are flushed within FlushInterval.
+func (s *StreamSuite) TestFlushWhileBlocked(c *C) {
+	ch := make(chan interface{})
+	stream := NewStream(StreamNDJSON, StreamChan(ch))
+	stream.FlushInterval = 20 * time.Millisecond
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan string, 10)}
+	go func() { ch <- 1 }()
+	c.Assert(stream.prepare(), IsNil)
+
+	errs := make(chan error)
+	go func() { errs <- stream.writeTo(w, http.StatusOK) }()
+	select {
+	case body := <-w.flushed:
+		c.Assert(body, Equals, "1\n")
+	case <-time.After(time.Second):
+		c.Fatal("the items were not flushed while the iterator was blocked")
+	}
+	close(ch)
+	c.Assert(<-errs, IsNil)
+}
+
+func (s *StreamSuite) TestNoContent(c *C) {
+	fn := func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+		return HandlerResult{Status: http.StatusNoContent, Body: NewStream(StreamJSONArray, sliceIterator(1, 2))}, nil
+	}
+	w := httptest.NewRecorder()
+	MakeHandler(s.app, fn, Spec{})(w, httptest.NewRequest("GET", "/events", nil))
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+	c.Assert(w.Body.String(), Equals, "")
+}
+
+// flushRecorder sends the body written so far whenever the response is flushed.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan string
+}
+
+func (w *flushRecorder) Flush() {
+	w.ResponseRecorder.Flush()
+	w.flushed <- w.Body.String()
+}
+
+func (s *StreamSuite) TestErrors(c *C) {
+	// An error before the first item is replied like a handler error.
+	w := s.serve(NewStream(StreamJSONArray, sliceIterator(NotFoundError{"no events"})))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+	c.Assert(w.Body.String(), Equals, `{"message":"no events","request_id":"test"}`)
+
+	// A later error just ends the response.
+	w = s.serve(NewStream(StreamJSONArray, sliceIterator(1, errors.New("boom"))))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `[1`)
+}
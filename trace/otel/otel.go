@@ -0,0 +1,130 @@
+//go:build go1.18
+// +build go1.18
+
+// Package otel provides a scroll Tracer that starts OpenTelemetry spans, e.g.:
+//
+//  app, err := scroll.NewAppWithConfig(scroll.AppConfig{
+//      Name:   "users",
+//      Tracer: otel.NewTracer(provider.Tracer("github.com/mailgun/users")),
+//  })
+//
+// Spans continue the trace of the W3C trace context of incoming requests, unless the context already
+// has an OpenTelemetry span, e.g. one started by a middleware of the app.
+//
+// OpenTelemetry requires a recent version of Go, so the package is only built by the versions that
+// support generics, and is not managed by dep: apps using it require go.opentelemetry.io/otel in
+// their own go.mod.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mailgun/scroll/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts the spans with an OpenTelemetry tracer.
+type Tracer struct {
+	tracer oteltrace.Tracer
+}
+
+// NewTracer creates a tracer that starts the spans with the OpenTelemetry tracer.
+func NewTracer(tracer oteltrace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		if parent := trace.RemoteParent(ctx); parent.IsValid() {
+			ctx = oteltrace.ContextWithRemoteSpanContext(ctx, toOtel(parent))
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, name, oteltrace.WithSpanKind(toOtelKind(kind)))
+	s := &Span{span: span}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// Span is a scroll span backed by an OpenTelemetry span.
+type Span struct {
+	span oteltrace.Span
+}
+
+// OtelSpan returns the OpenTelemetry span, e.g. to add events to it.
+func (s *Span) OtelSpan() oteltrace.Span {
+	return s.span
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(toAttribute(key, value))
+}
+
+func (s *Span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *Span) End() {
+	s.span.End()
+}
+
+func (s *Span) SpanContext() trace.SpanContext {
+	sc := s.span.SpanContext()
+	return trace.SpanContext{
+		TraceID:    sc.TraceID(),
+		SpanID:     sc.SpanID(),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+	}
+}
+
+// toOtel converts the span context received from another service to an OpenTelemetry one. A trace
+// state that can not be parsed is dropped, as the W3C trace context requires.
+func toOtel(sc trace.SpanContext) oteltrace.SpanContext {
+	var flags oteltrace.TraceFlags
+	if sc.Sampled {
+		flags = oteltrace.FlagsSampled
+	}
+	state, _ := oteltrace.ParseTraceState(sc.TraceState)
+	return oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    sc.TraceID,
+		SpanID:     sc.SpanID,
+		TraceFlags: flags,
+		TraceState: state,
+		Remote:     true,
+	})
+}
+
+func toOtelKind(kind trace.SpanKind) oteltrace.SpanKind {
+	switch kind {
+	case trace.SpanKindServer:
+		return oteltrace.SpanKindServer
+	case trace.SpanKindClient:
+		return oteltrace.SpanKindClient
+	default:
+		return oteltrace.SpanKindInternal
+	}
+}
+
+// toAttribute converts the attribute to the OpenTelemetry type matching the value, or to a string
+// if there is none.
+func toAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
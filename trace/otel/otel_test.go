@@ -0,0 +1,97 @@
+//go:build go1.18
+// +build go1.18
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mailgun/scroll/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	. "gopkg.in/check.v1"
+)
+
+func TestOtel(t *testing.T) {
+	TestingT(t)
+}
+
+type OtelSuite struct {
+	recorder *tracetest.SpanRecorder
+	tracer   *Tracer
+}
+
+var _ = Suite(&OtelSuite{})
+
+func (s *OtelSuite) SetUpTest(c *C) {
+	s.recorder = tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.recorder))
+	s.tracer = NewTracer(provider.Tracer("test"))
+}
+
+func (s *OtelSuite) TestPropagation(c *C) {
+	in := http.Header{}
+	in.Set(trace.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set(trace.TraceStateHeader, "vendor=abc")
+	ctx := trace.Extract(context.Background(), in)
+
+	ctx, span := s.tracer.Start(ctx, "GET /users", trace.SpanKindServer)
+	childCtx, child := s.tracer.Start(ctx, "query", trace.SpanKindClient)
+	out := http.Header{}
+	trace.Inject(childCtx, out)
+	child.End()
+	span.End()
+
+	spans := s.recorder.Ended()
+	c.Assert(spans, HasLen, 2)
+	server, client := spans[1], spans[0]
+	c.Assert(server.SpanKind(), Equals, oteltrace.SpanKindServer)
+	c.Assert(server.Parent().TraceID().String(), Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Assert(server.Parent().SpanID().String(), Equals, "00f067aa0ba902b7")
+	c.Assert(server.Parent().IsRemote(), Equals, true)
+	c.Assert(client.SpanKind(), Equals, oteltrace.SpanKindClient)
+	c.Assert(client.Parent().SpanID(), Equals, server.SpanContext().SpanID())
+
+	c.Assert(out.Get(trace.TraceParentHeader), Equals, child.SpanContext().TraceParent())
+	c.Assert(out.Get(trace.TraceStateHeader), Equals, "vendor=abc")
+	c.Assert(child.SpanContext().TraceID, Equals, [16]byte(server.Parent().TraceID()))
+}
+
+// Spans are children of the OpenTelemetry span in the context rather than of the remote parent.
+func (s *OtelSuite) TestOtelParent(c *C) {
+	in := http.Header{}
+	in.Set(trace.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := s.tracer.tracer.Start(trace.Extract(context.Background(), in), "middleware")
+	_, span := s.tracer.Start(ctx, "GET /users", trace.SpanKindServer)
+	span.End()
+	parent.End()
+
+	c.Assert(s.recorder.Ended()[0].Parent().SpanID(), Equals, parent.SpanContext().SpanID())
+}
+
+func (s *OtelSuite) TestAttributes(c *C) {
+	_, span := s.tracer.Start(context.Background(), "GET /users", trace.SpanKindServer)
+	span.SetAttribute("http.method", "GET")
+	span.SetAttribute("http.status_code", 500)
+	span.SetAttribute("error", true)
+	span.SetAttribute("scroll.elapsed", struct{ Ms int }{5})
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	ended := s.recorder.Ended()[0]
+	c.Assert(ended.Attributes(), DeepEquals, []attribute.KeyValue{
+		attribute.String("http.method", "GET"),
+		attribute.Int("http.status_code", 500),
+		attribute.Bool("error", true),
+		attribute.String("scroll.elapsed", "{5}"),
+	})
+	c.Assert(ended.Status().Code, Equals, codes.Error)
+	c.Assert(ended.Status().Description, Equals, "boom")
+	c.Assert(ended.Events(), HasLen, 1)
+}
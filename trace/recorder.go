@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder is a Tracer that keeps the ended spans in memory, e.g. to check the spans in tests or
+// to log them while debugging.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span started by a Recorder.
+type RecordedSpan struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]interface{}
+	Err        error
+
+	recorder *Recorder
+}
+
+// NewRecorder creates a recorder without spans.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent := Parent(ctx)
+	span := &RecordedSpan{
+		Name:       name,
+		Kind:       kind,
+		Context:    NewSpanContext(parent),
+		Parent:     parent,
+		Attributes: make(map[string]interface{}),
+		recorder:   r,
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns the spans ended so far, in the order they ended.
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*RecordedSpan(nil), r.spans...)
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.recorder.mu.Lock()
+	s.Attributes[key] = value
+	s.recorder.mu.Unlock()
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.recorder.mu.Lock()
+	s.Err = err
+	s.recorder.mu.Unlock()
+}
+
+func (s *RecordedSpan) End() {
+	s.recorder.mu.Lock()
+	s.recorder.spans = append(s.recorder.spans, s)
+	s.recorder.mu.Unlock()
+}
+
+func (s *RecordedSpan) SpanContext() SpanContext {
+	return s.Context
+}
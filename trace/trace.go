@@ -0,0 +1,220 @@
+// Package trace defines the tracing hooks of scroll apps and of the vulcand registry.
+//
+// Apps provide a Tracer that starts spans with the tracing library of their choice. Package
+// github.com/mailgun/scroll/trace/otel provides one for OpenTelemetry.
+//
+// The W3C trace context of incoming requests, the traceparent and tracestate headers, is parsed by
+// scroll and passed to the tracer as the remote parent of the server spans, and Transport sets it
+// on the outgoing requests of the app, so tracers do not have to implement propagation themselves.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers carrying the W3C trace context, see https://www.w3.org/TR/trace-context/.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// SpanKind is the role of a span in a trace.
+type SpanKind int
+
+const (
+	// SpanKindInternal is a span of an operation that does not cross process boundaries.
+	SpanKindInternal SpanKind = iota
+
+	// SpanKindServer is a span of a request served by the process.
+	SpanKindServer
+
+	// SpanKindClient is a span of a request made by the process, e.g. to etcd.
+	SpanKindClient
+)
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span as a child of the span in the context, or of the remote parent in
+	// the context if there is no span, and returns a context with the started span.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// SetAttribute annotates the span with the key/value pair, e.g. "http.status_code".
+	SetAttribute(key string, value interface{})
+
+	// RecordError marks the span as failed with the error.
+	RecordError(err error)
+
+	// End finishes the span.
+	End()
+
+	// SpanContext returns the identifiers of the span to propagate to other services.
+	SpanContext() SpanContext
+}
+
+// SpanContext identifies a span across processes.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+
+	// Vendor specific trace state, the value of the tracestate header, passed along as is.
+	TraceState string
+}
+
+// IsValid tells whether the trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the span context as a W3C traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent: %q", value)
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, fmt.Errorf("invalid trace ID in traceparent: %q", value)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, fmt.Errorf("invalid span ID in traceparent: %q", value)
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, fmt.Errorf("invalid flags in traceparent: %q", value)
+	}
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent: %q", value)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return fmt.Errorf("invalid length or case")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+type spanKey struct{}
+type remoteParentKey struct{}
+
+// ContextWithSpan returns a context with the span, for tracers to pass spans to their children.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in the context, or nil if there is none.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a context with the span context received from another service.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+// RemoteParent returns the span context received from another service, or an invalid span context
+// if there is none.
+func RemoteParent(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(remoteParentKey{}).(SpanContext)
+	return sc
+}
+
+// Extract returns a context with the remote parent from the traceparent and tracestate headers, if
+// the traceparent header is valid.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceParent(header.Get(TraceParentHeader))
+	if err != nil {
+		return ctx
+	}
+	// The header may be split into several fields, which are concatenated.
+	sc.TraceState = strings.Join(header[http.CanonicalHeaderKey(TraceStateHeader)], ",")
+	return ContextWithRemoteParent(ctx, sc)
+}
+
+// Inject sets the traceparent and tracestate headers to the span in the context, so that the span
+// becomes the parent of the spans of the service the request is made to. Transport injects the
+// headers of the requests it makes; apps making requests otherwise inject them themselves, e.g.:
+//
+//  trace.Inject(r.Context(), req.Header)
+//
+// The header is not set if the context has no span.
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		header.Set(TraceParentHeader, sc.TraceParent())
+		if sc.TraceState != "" {
+			header.Set(TraceStateHeader, sc.TraceState)
+		} else {
+			header.Del(TraceStateHeader)
+		}
+	}
+}
+
+// NewSpanContext returns a span context with a random span ID that continues the trace of the parent,
+// keeping its trace state, or starts a new sampled trace if the parent is not valid. Tracers can use it
+// to identify their spans.
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := parent
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+		sc.Sampled = true
+	}
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// Parent returns the span context of the span in the context, or the remote parent if there is no span.
+func Parent(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	return RemoteParent(ctx)
+}
+
+// NoopTracer starts spans that do nothing, for when tracing is not configured.
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
+func (noopSpan) SpanContext() SpanContext                   { return SpanContext{} }
+
+// End records the error, if any, and ends the span. It is handy for ending spans with deferred calls.
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
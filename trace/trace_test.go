@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestTrace(t *testing.T) {
+	TestingT(t)
+}
+
+type TraceSuite struct{}
+
+var _ = Suite(&TraceSuite{})
+
+func (s *TraceSuite) TestParseTraceParent(c *C) {
+	for i, tc := range []struct {
+		value   string
+		sampled bool
+		valid   bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, true},
+		// Future versions may append fields.
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", false, false},
+		{"", false, false},
+	} {
+		c.Logf("Test case #%d", i)
+		sc, err := ParseTraceParent(tc.value)
+		if !tc.valid {
+			c.Assert(err, NotNil)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(sc.Sampled, Equals, tc.sampled)
+		if tc.value[:2] == "00" {
+			c.Assert(sc.TraceParent(), Equals, tc.value)
+		}
+	}
+}
+
+func (s *TraceSuite) TestPropagation(c *C) {
+	in := http.Header{}
+	in.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), in)
+
+	recorder := NewRecorder()
+	ctx, span := recorder.Start(ctx, "GET /users", SpanKindServer)
+	_, child := recorder.Start(ctx, "query", SpanKindClient)
+	child.End()
+	span.End()
+
+	spans := recorder.Spans()
+	c.Assert(spans, HasLen, 2)
+	c.Assert(spans[1].Parent.TraceParent(), Equals, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	c.Assert(spans[1].Context.TraceID, Equals, spans[1].Parent.TraceID)
+	c.Assert(spans[1].Context.SpanID, Not(Equals), spans[1].Parent.SpanID)
+	c.Assert(spans[0].Parent, Equals, spans[1].Context)
+
+	out := http.Header{}
+	Inject(ctx, out)
+	c.Assert(out.Get(TraceParentHeader), Equals, spans[1].Context.TraceParent())
+
+	// The trace state is passed along with the trace.
+	in.Set(TraceStateHeader, "vendor=abc")
+	in.Add(TraceStateHeader, "other=1")
+	ctx, span = recorder.Start(Extract(context.Background(), in), "GET /users", SpanKindServer)
+	c.Assert(span.SpanContext().TraceState, Equals, "vendor=abc,other=1")
+	out = http.Header{}
+	Inject(ctx, out)
+	c.Assert(out.Get(TraceStateHeader), Equals, "vendor=abc,other=1")
+
+	// Nothing is injected without a span.
+	out = http.Header{}
+	Inject(context.Background(), out)
+	c.Assert(out.Get(TraceParentHeader), Equals, "")
+}
+
+func (s *TraceSuite) TestTransport(c *C) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceParentHeader)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder()
+	ctx, parent := recorder.Start(context.Background(), "GET /users", SpanKindServer)
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	c.Assert(err, IsNil)
+	resp, err := (&http.Client{Transport: &Transport{Tracer: recorder}}).Do(req.WithContext(ctx))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Spans()
+	c.Assert(spans, HasLen, 2)
+	c.Assert(spans[0].Kind, Equals, SpanKindClient)
+	c.Assert(spans[0].Parent, Equals, spans[1].Context)
+	c.Assert(spans[0].Attributes["http.status_code"], Equals, http.StatusAccepted)
+	c.Assert(received, Equals, spans[0].Context.TraceParent())
+	// The request of the caller is left as is.
+	c.Assert(req.Header.Get(TraceParentHeader), Equals, "")
+
+	// Without a tracer the span of the context is propagated.
+	resp, err = (&http.Client{Transport: &Transport{}}).Do(req.WithContext(ctx))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(received, Equals, spans[1].Context.TraceParent())
+}
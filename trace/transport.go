@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that makes requests within client spans of the tracer and sets
+// the traceparent and tracestate headers of the requests, so that the spans of the called services
+// continue the trace. Apps make their outgoing requests with it to propagate the spans of the
+// requests they serve:
+//
+//  client := &http.Client{Transport: &trace.Transport{Tracer: tracer}}
+//  req = req.WithContext(r.Context())
+//
+// Without a tracer no span is started and the span in the context of the request, if any, is
+// propagated as is.
+type Transport struct {
+	// Tracer to start the client spans with.
+	Tracer Tracer
+
+	// Transport to make the requests with, http.DefaultTransport if not specified.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	span := Span(noopSpan{})
+	if t.Tracer != nil {
+		ctx, span = t.Tracer.Start(ctx, req.Method+" "+req.URL.Host, SpanKindClient)
+		ctx = ContextWithSpan(ctx, span)
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.url", req.URL.String())
+	}
+
+	// A RoundTripper must not modify the request, so the header is set on a copy.
+	out := req.WithContext(ctx)
+	out.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+	Inject(ctx, out.Header)
+
+	resp, err := base.RoundTrip(out)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	span.End()
+	return resp, nil
+}
@@ -0,0 +1,57 @@
+package scroll
+
+import (
+	"net/http"
+
+	"github.com/mailgun/scroll/trace"
+)
+
+// traceRequests wraps the handler made for the spec so that every request is served within a server
+// span of the app's tracer. The span continues the trace of the W3C trace context of the request,
+// if any, and is named after the matched route, e.g. "GET /v3/{domain}/events", or after the metric
+// of the handler if the request was not routed by mux.
+func (app *App) traceRequests(spec Spec, handler http.Handler) http.Handler {
+	if app.Config.Tracer == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := trace.Extract(r.Context(), r.Header)
+		ctx, span := app.Config.Tracer.Start(ctx, spanName(spec, r), trace.SpanKindServer)
+		ctx = trace.ContextWithSpan(ctx, span)
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		if route := routeTemplate(r); route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("scroll.metric", metricID(spec, r))
+		span.SetAttribute("scroll.request_id", RequestID(r))
+
+		rw := newResponseWriter(w)
+		handler.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rw.status)
+		if rw.status >= http.StatusInternalServerError {
+			span.SetAttribute("error", true)
+		}
+	})
+}
+
+// spanName returns the name of the server span of the request served by a handler made for the spec.
+func spanName(spec Spec, r *http.Request) string {
+	if routeTemplate(r) != "" {
+		return RouteKey(r)
+	}
+	return r.Method + " " + metricID(spec, r)
+}
+
+// traceError records the error a request failed with on the span of the request, if it is traced.
+func traceError(r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	if span := trace.SpanFromContext(r.Context()); span != nil {
+		span.RecordError(err)
+	}
+}
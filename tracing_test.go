@@ -0,0 +1,80 @@
+package scroll
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/mailgun/scroll/trace"
+	. "gopkg.in/check.v1"
+)
+
+type TracingSuite struct{}
+
+var _ = Suite(&TracingSuite{})
+
+func (s *TracingSuite) SetUpSuite(c *C) {
+	os.Unsetenv("MG_ENV")
+}
+
+func (s *TracingSuite) TestServerSpans(c *C) {
+	recorder := trace.NewRecorder()
+	app, err := NewAppWithConfig(AppConfig{Name: "test", Tracer: recorder})
+	c.Assert(err, IsNil)
+
+	var traceParent string
+	c.Assert(app.AddHandler(Spec{
+		Methods: []string{"GET"},
+		Paths:   []string{"/v3/{domain}/events"},
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			header := http.Header{}
+			trace.Inject(r.Context(), header)
+			traceParent = header.Get(trace.TraceParentHeader)
+			return Response{}, nil
+		},
+	}), IsNil)
+	c.Assert(app.AddHandler(Spec{
+		Methods:    []string{"POST"},
+		Paths:      []string{"/users"},
+		MetricName: "create_user",
+		Handler: func(w http.ResponseWriter, r *http.Request, params map[string]string) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+	}), IsNil)
+
+	r := httptest.NewRequest("GET", "/v3/example.com/events", nil)
+	r.Header.Set(trace.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set(RequestIDHeader, "test")
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.Spans()
+	c.Assert(spans, HasLen, 1)
+	span := spans[0]
+	c.Assert(span.Name, Equals, "GET /v3/{domain}/events")
+	c.Assert(span.Kind, Equals, trace.SpanKindServer)
+	c.Assert(span.Parent.TraceParent(), Equals, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	c.Assert(span.Context.TraceID, Equals, span.Parent.TraceID)
+	c.Assert(traceParent, Equals, span.Context.TraceParent())
+	c.Assert(span.Attributes, DeepEquals, map[string]interface{}{
+		"http.method":       "GET",
+		"http.route":        "/v3/{domain}/events",
+		"http.target":       "/v3/example.com/events",
+		"http.status_code":  http.StatusOK,
+		"scroll.metric":     "get_v3_domain_events",
+		"scroll.request_id": "test",
+	})
+	c.Assert(span.Err, IsNil)
+
+	app.GetHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+
+	spans = recorder.Spans()
+	c.Assert(spans, HasLen, 2)
+	span = spans[1]
+	c.Assert(span.Name, Equals, "POST /users")
+	c.Assert(span.Parent.IsValid(), Equals, false)
+	c.Assert(span.Attributes["scroll.metric"], Equals, "create_user")
+	c.Assert(span.Attributes["http.status_code"], Equals, http.StatusInternalServerError)
+	c.Assert(span.Attributes["error"], Equals, true)
+	c.Assert(span.Err, ErrorMatches, "boom")
+}
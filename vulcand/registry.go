@@ -4,29 +4,77 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	etcd "github.com/coreos/etcd/clientv3"
 	"github.com/mailgun/log"
+	"github.com/mailgun/scroll/trace"
 	"github.com/pkg/errors"
 )
 
 const (
 	reconnectInterval = time.Second
+	deregisterTimeout = 5 * time.Second
+	frontendsFmt      = "%s/frontends/"
+	frontendDirFmt    = "%s/frontends/%s.%s/"
 	frontendFmt       = "%s/frontends/%s.%s/frontend"
 	middlewareFmt     = "%s/frontends/%s.%s/middlewares/%s"
 	backendFmt        = "%s/backends/%s/backend"
 	serverFmt         = "%s/backends/%s/servers/%s"
+	serversFmt        = "%s/backends/%s/servers/"
+	declarationFmt    = "%s/scroll/declarations/%s/%s"
+	declarationsFmt   = "%s/scroll/declarations/%s/"
+)
+
+// FrontendCleanup defines what happens to the frontends and middlewares of an app when its last
+// instance deregisters.
+type FrontendCleanup int
+
+const (
+	// CleanupNone leaves the frontends in place, so that vulcand replies with 502 to their requests
+	// until the app registers again.
+	CleanupNone FrontendCleanup = iota
+
+	// CleanupDelete deletes the frontends, so that vulcand replies with 404 to their requests.
+	CleanupDelete
+
+	// CleanupExpire binds the frontends to a lease that expires after Config.CleanupGracePeriod. If an
+	// instance of the app registers before that, e.g. during a restart, the frontends are kept.
+	CleanupExpire
+)
+
+// Statuses of the registration.
+const (
+	stopped int32 = iota
+	connected
+	reconnecting
+	alive
 )
 
 type Config struct {
 	Namespace string
 	Etcd      *etcd.Config
 	TTL       time.Duration
+
+	// Tracer to trace the etcd operations with, if any.
+	Tracer trace.Tracer
+
+	// What happens to the frontends of the app when its last instance deregisters, CleanupNone
+	// if not specified.
+	Cleanup FrontendCleanup
+
+	// Time the frontends live after the last instance deregisters with CleanupExpire, TTL if not specified.
+	CleanupGracePeriod time.Duration
 }
 
 type Registry struct {
+	// Guards the frontends, the etcd client and traceCtx, so that frontends can be changed while the
+	// registry is running.
+	mu            sync.Mutex
+	registered    bool
 	cfg           Config
 	client        *etcd.Client
 	backendSpec   *backendSpec
@@ -36,8 +84,10 @@ type Registry struct {
 	wg            sync.WaitGroup
 	leaseID       etcd.LeaseID
 	keepAliveChan <-chan *etcd.LeaseKeepAliveResponse
-	once          *sync.Once
+	stopping      bool
 	done          chan struct{}
+	traceCtx      context.Context
+	status        int32
 }
 
 func NewRegistry(cfg Config, appName, ip string, port int) (*Registry, error) {
@@ -53,8 +103,160 @@ func NewRegistry(cfg Config, appName, ip string, port int) (*Registry, error) {
 	return &c, nil
 }
 
-func (r *Registry) AddFrontend(host, path string, methods []string, middlewares []Middleware) {
-	r.frontendSpecs = append(r.frontendSpecs, newFrontendSpec(r.backendSpec.AppName, host, path, methods, middlewares))
+// AddFrontend adds a frontend routing the requests to the host, path and methods to the app, replacing
+// the frontend of the same route if any. If the app is registered already the frontend is written
+// to etcd right away, otherwise it is written when the app registers. If writing fails the error is
+// returned, but the frontend is kept and written when the registry reconnects to etcd.
+func (r *Registry) AddFrontend(host, path string, methods []string, middlewares []Middleware) error {
+	fes := newFrontendSpec(r.backendSpec.AppName, host, path, methods, middlewares)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var replaced *frontendSpec
+	i := r.frontendIndex(fes.Host, fes.ID)
+	if i >= 0 {
+		replaced = r.frontendSpecs[i]
+		r.frontendSpecs[i] = fes
+	} else {
+		r.frontendSpecs = append(r.frontendSpecs, fes)
+	}
+	if !r.registered {
+		return nil
+	}
+	if err := r.declare(); err != nil {
+		return err
+	}
+	if err := r.registerFrontend(fes); err != nil {
+		return errors.Wrapf(err, "failed to register frontend, %s", fes.ID)
+	}
+	if i >= 0 {
+		// Middlewares the replaced frontend had are not overwritten, so they have to be removed.
+		return r.removeMiddlewares(replaced, fes)
+	}
+	return nil
+}
+
+// removeMiddlewares deletes the middlewares of the replaced frontend that the new one does not have,
+// unless another instance of the app still declares them.
+func (r *Registry) removeMiddlewares(replaced, fes *frontendSpec) error {
+	declared, err := r.declarations()
+	if err != nil {
+		return err
+	}
+	for _, mw := range replaced.Middlewares {
+		if declared[fes.Host+"."+fes.ID][mw.ID] {
+			continue
+		}
+		key := fmt.Sprintf(middlewareFmt, r.cfg.Namespace, fes.Host, fes.ID, mw.ID)
+		if _, err := r.client.Delete(r.ctx, key); err != nil {
+			return errors.Wrapf(err, "failed to delete middleware, %s", key)
+		}
+	}
+	return nil
+}
+
+// RemoveFrontend removes the frontend of the route. If the app is registered the frontend and its
+// middlewares are deleted from etcd right away, unless another instance of the app still declares the
+// frontend, otherwise they are deleted when the app registers.
+func (r *Registry) RemoveFrontend(host, path string, methods []string) error {
+	fes := newFrontendSpec(r.backendSpec.AppName, host, path, methods, nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.frontendIndex(fes.Host, fes.ID)
+	if i < 0 {
+		return errors.Errorf("frontend not found, %s", fes.ID)
+	}
+	r.frontendSpecs = append(r.frontendSpecs[:i:i], r.frontendSpecs[i+1:]...)
+	if !r.registered {
+		return nil
+	}
+	if err := r.declare(); err != nil {
+		return err
+	}
+	declared, err := r.declarations()
+	if err != nil {
+		return err
+	}
+	if _, ok := declared[fes.Host+"."+fes.ID]; ok {
+		// Another instance of the app still routes the frontend.
+		return nil
+	}
+
+	span := r.startSpan("vulcand.removeFrontend", fes.ID)
+	key := fmt.Sprintf(frontendDirFmt, r.cfg.Namespace, fes.Host, fes.ID)
+	_, err = r.client.Delete(r.ctx, key, etcd.WithPrefix())
+	trace.End(span, err)
+	return errors.Wrapf(err, "failed to delete frontend, %s", key)
+}
+
+// declare writes the frontends the instance declares and their middlewares under its lease, so that
+// the other instances of the app do not remove them as stale.
+func (r *Registry) declare() error {
+	frontends := make(map[string][]string, len(r.frontendSpecs))
+	for _, fes := range r.frontendSpecs {
+		ids := make([]string, len(fes.Middlewares))
+		for i, mw := range fes.Middlewares {
+			ids[i] = mw.ID
+		}
+		frontends[fes.Host+"."+fes.ID] = ids
+	}
+	val, err := json.Marshal(frontends)
+	if err != nil {
+		return errors.Wrap(err, "failed to JSON frontend declaration")
+	}
+	key := fmt.Sprintf(declarationFmt, r.cfg.Namespace, r.backendSpec.AppName, r.backendSpec.ID)
+	_, err = r.client.Put(r.ctx, key, string(val), etcd.WithLease(r.leaseID))
+	return errors.Wrapf(err, "failed to declare frontends, %s", key)
+}
+
+// declarations returns the middleware IDs by the frontend name, e.g. "host.get.users", of the frontends
+// declared by the registered instances of the app, including this one. Declarations expire with the
+// leases of the instances, so the frontends of instances that are gone are not included.
+func (r *Registry) declarations() (map[string]map[string]bool, error) {
+	prefix := fmt.Sprintf(declarationsFmt, r.cfg.Namespace, r.backendSpec.AppName)
+	resp, err := r.client.Get(r.ctx, prefix, etcd.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list frontend declarations, %s", prefix)
+	}
+	declared := make(map[string]map[string]bool)
+	add := func(name string, ids []string) {
+		if declared[name] == nil {
+			declared[name] = make(map[string]bool)
+		}
+		for _, id := range ids {
+			declared[name][id] = true
+		}
+	}
+	for _, kv := range resp.Kvs {
+		var frontends map[string][]string
+		if err := json.Unmarshal(kv.Value, &frontends); err != nil {
+			log.Errorf("invalid frontend declaration key=%s err=(%v)", kv.Key, err)
+			continue
+		}
+		for name, ids := range frontends {
+			add(name, ids)
+		}
+	}
+	// The declaration of this instance may be being written.
+	for _, fes := range r.frontendSpecs {
+		var ids []string
+		for _, mw := range fes.Middlewares {
+			ids = append(ids, mw.ID)
+		}
+		add(fes.Host+"."+fes.ID, ids)
+	}
+	return declared, nil
+}
+
+// frontendIndex returns the position of the frontend with the host and ID, or -1 if there is none.
+func (r *Registry) frontendIndex(host, id string) int {
+	for i, fes := range r.frontendSpecs {
+		if fes.Host == host && fes.ID == id {
+			return i
+		}
+	}
+	return -1
 }
 
 func (r *Registry) createNewLease() error {
@@ -63,36 +265,37 @@ func (r *Registry) createNewLease() error {
 
 func (r *Registry) Start() error {
 	heartBeatTicker := time.Tick(r.cfg.TTL)
+	r.mu.Lock()
 	r.done = make(chan struct{})
-	r.once = &sync.Once{}
+	r.stopping = false
+	done := r.done
+	r.mu.Unlock()
 
-	// Report any errors the first time we connect
-	if err := r.connectAndRegister(); err != nil {
+	// Report any errors the first time we connect. Stale frontends are only removed now, because
+	// while the app is running other instances, e.g. of a newer version being deployed, may declare
+	// frontends this one does not know about.
+	if err := r.connectAndRegister(true); err != nil {
 		return err
 	}
-
-	const (
-		connected = iota + 1
-		reconnecting
-		alive
-	)
+	r.setStatus(connected)
 
 	r.wg.Add(1)
 	go func() {
-		var status int
+		defer r.wg.Done()
 		for {
 			select {
 			case <-heartBeatTicker:
 				// If we have NOT received a keep alive response during the ticker interval
 				// assume we should reconnect and register
-				if status != alive {
+				if r.getStatus() != alive {
 					for {
-						if err := r.connectAndRegister(); err != nil {
+						if err := r.connectAndRegister(false); err != nil {
 							log.Errorf("while reconnecting to etcd: %s", err)
-							status = reconnecting
+							r.setStatus(reconnecting)
 							wait := time.After(reconnectInterval)
 							select {
-							case <-r.done:
+							case <-done:
+								r.setStatus(stopped)
 								return
 							case <-wait:
 								continue
@@ -102,16 +305,15 @@ func (r *Registry) Start() error {
 					}
 				}
 				// This just indicates we reconnected, but haven't received a keep alive response
-				status = connected
+				r.setStatus(connected)
 			case keep := <-r.keepAliveChan:
 				if keep != nil {
 					log.Debugf("keep alive %+v", keep)
-					status = alive
+					r.setStatus(alive)
 				}
-			case <-r.done:
-				_, err := r.client.Revoke(context.Background(), r.leaseID)
-				log.Infof("lease revoked err=(%v)", err)
-				r.wg.Done()
+			case <-done:
+				r.setStatus(stopped)
+				r.deregister()
 				return
 			}
 		}
@@ -120,8 +322,22 @@ func (r *Registry) Start() error {
 	return nil
 }
 
-func (r *Registry) connectAndRegister() error {
-	var err error
+// connectAndRegister connects to etcd and writes the backend, server and frontends of the app. If
+// removeStale is true the frontends the app does not declare are removed before the frontends are written.
+func (r *Registry) connectAndRegister(removeStale bool) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The span is the parent of the spans of the etcd operations made while registering, so it is kept
+	// in traceCtx until the registration is over.
+	var span trace.Span
+	r.traceCtx, span = r.tracer().Start(context.Background(), "vulcand.connectAndRegister", trace.SpanKindClient)
+	span.SetAttribute("vulcand.namespace", r.cfg.Namespace)
+	defer func() {
+		r.traceCtx = nil
+		trace.End(span, err)
+	}()
+	r.registered = false
 
 	// If we are reconnecting, cancel the previous connections
 	if r.cancelFunc != nil {
@@ -161,30 +377,94 @@ func (r *Registry) connectAndRegister() error {
 	if err != nil {
 		return errors.Wrap(err, "failed to write backend spec")
 	}
+	if err := r.declare(); err != nil {
+		return err
+	}
 
+	if removeStale {
+		if err := r.removeStaleFrontends(); err != nil {
+			log.Errorf("failed to remove stale frontends: %s", err)
+		}
+	}
 	for _, fes := range r.frontendSpecs {
 		if err := r.registerFrontend(fes); err != nil {
 			r.cancelFunc()
 			return errors.Wrapf(err, "failed to register frontend, %s", fes.ID)
 		}
 	}
+	r.registered = true
 	return nil
 }
 
+// deregister removes the server of the app from vulcand and revokes the lease, so that vulcand stops
+// sending requests to the app without waiting for the lease to expire.
+func (r *Registry) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = false
+
+	_, span := r.tracer().Start(ctx, "vulcand.deregister", trace.SpanKindClient)
+	key := fmt.Sprintf(serverFmt, r.cfg.Namespace, r.backendSpec.AppName, r.backendSpec.ID)
+	_, err := r.client.Delete(ctx, key)
+	log.Infof("server removed key=%v err=(%v)", key, err)
+	if err == nil && r.cfg.Cleanup != CleanupNone {
+		err = r.cleanupFrontends(ctx)
+	}
+	_, revokeErr := r.client.Revoke(ctx, r.leaseID)
+	log.Infof("lease revoked err=(%v)", revokeErr)
+	if err == nil {
+		err = revokeErr
+	}
+	// A reconnect may have completed while the registry was stopping.
+	r.cancelFunc()
+	trace.End(span, err)
+}
+
+// Healthy returns an error if the app is not registered, because the registry is not running or has
+// lost its etcd lease and is trying to reconnect.
+func (r *Registry) Healthy() error {
+	switch r.getStatus() {
+	case stopped:
+		return errors.New("vulcand registration is not running")
+	case reconnecting:
+		return errors.New("vulcand registration lease is lost, reconnecting to etcd")
+	}
+	return nil
+}
+
+func (r *Registry) getStatus() int32 {
+	return atomic.LoadInt32(&r.status)
+}
+
+func (r *Registry) setStatus(status int32) {
+	atomic.StoreInt32(&r.status, status)
+}
+
+// Stop deregisters the app and waits for the registry to stop. It is safe to call Stop several times and
+// from several goroutines.
 func (r *Registry) Stop() {
+	r.mu.Lock()
 	if r.cancelFunc != nil {
 		r.cancelFunc()
 	}
-	if r.once != nil {
-		r.once.Do(func() { close(r.done) })
+	if r.done != nil && !r.stopping {
+		r.stopping = true
+		close(r.done)
 	}
+	r.mu.Unlock()
 	r.wg.Wait()
 }
 
-func (r *Registry) registerBackend(bes *backendSpec) error {
+func (r *Registry) registerBackend(bes *backendSpec) (err error) {
+	span := r.startSpan("vulcand.registerBackend", bes.ID)
+	defer func() { trace.End(span, err) }()
+
 	betKey := fmt.Sprintf(backendFmt, r.cfg.Namespace, bes.AppName)
 	betVal := bes.typeSpec()
-	_, err := r.client.Put(r.ctx, betKey, betVal)
+	_, err = r.client.Put(r.ctx, betKey, betVal)
 	if err != nil {
 		return errors.Wrapf(err, "failed to set backend type, %s", betKey)
 	}
@@ -194,10 +474,18 @@ func (r *Registry) registerBackend(bes *backendSpec) error {
 	return errors.Wrapf(err, "failed to set backend spec, %s", besKey)
 }
 
-func (r *Registry) registerFrontend(fes *frontendSpec) error {
+func (r *Registry) registerFrontend(fes *frontendSpec) (err error) {
+	span := r.startSpan("vulcand.registerFrontend", fes.ID)
+	defer func() { trace.End(span, err) }()
+
+	return r.putFrontend(r.ctx, fes)
+}
+
+// putFrontend writes the frontend spec and its middlewares with the options, e.g. a lease.
+func (r *Registry) putFrontend(ctx context.Context, fes *frontendSpec, opts ...etcd.OpOption) error {
 	fesKey := fmt.Sprintf(frontendFmt, r.cfg.Namespace, fes.Host, fes.ID)
 	fesVal := fes.spec()
-	_, err := r.client.Put(r.ctx, fesKey, fesVal)
+	_, err := r.client.Put(ctx, fesKey, fesVal, opts...)
 	if err != nil {
 		return errors.Wrapf(err, "failed to set frontend spec, %s", fesKey)
 	}
@@ -208,10 +496,126 @@ func (r *Registry) registerFrontend(fes *frontendSpec) error {
 		if err != nil {
 			return errors.Wrapf(err, "failed to JSON middleware, %v", mw)
 		}
-		_, err = r.client.Put(r.ctx, mwKey, string(mwVal))
+		_, err = r.client.Put(ctx, mwKey, string(mwVal), opts...)
 		if err != nil {
 			return errors.Wrapf(err, "failed to set middleware, %s", mwKey)
 		}
 	}
 	return nil
 }
+
+// removeStaleFrontends deletes the frontends of the app that no registered instance of it declares
+// anymore, e.g. because a route was renamed, and the middlewares of the declared frontends that are
+// not declared anymore. During a rolling deploy the instances of the old and the new versions declare
+// different frontends, and the frontends of both are kept. Frontends are owned by the app which
+// backend they route to, so frontends of other apps sharing the namespace are left alone. It is
+// called once, when the registry starts.
+func (r *Registry) removeStaleFrontends() (err error) {
+	span := r.startSpan("vulcand.removeStaleFrontends", r.backendSpec.AppName)
+	defer func() { trace.End(span, err) }()
+
+	declared, err := r.declarations()
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf(frontendsFmt, r.cfg.Namespace)
+	resp, err := r.client.Get(r.ctx, prefix, etcd.WithPrefix())
+	if err != nil {
+		return errors.Wrapf(err, "failed to list frontends, %s", prefix)
+	}
+	for _, kv := range resp.Kvs {
+		parts := strings.SplitN(strings.TrimPrefix(string(kv.Key), prefix), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name, rest := parts[0], parts[1]
+		middlewares, ok := declared[name]
+
+		var key string
+		var opts []etcd.OpOption
+		switch {
+		case rest == "frontend" && !ok && frontendOwner(kv.Value) == r.backendSpec.AppName:
+			// Delete the whole frontend directory, including the middlewares.
+			key, opts = prefix+name+"/", []etcd.OpOption{etcd.WithPrefix()}
+		case strings.HasPrefix(rest, "middlewares/") && ok && !middlewares[strings.TrimPrefix(rest, "middlewares/")]:
+			key = string(kv.Key)
+		default:
+			continue
+		}
+		if _, err := r.client.Delete(r.ctx, key, opts...); err != nil {
+			return errors.Wrapf(err, "failed to delete stale frontend, %s", key)
+		}
+		log.Infof("stale frontend removed key=%v", key)
+	}
+	return nil
+}
+
+// cleanupFrontends deletes or expires the frontends of the app, as configured, if no other instance
+// of the app is registered. Instances that register at the same time may lose their frontends until
+// they register again, e.g. after reconnecting to etcd.
+func (r *Registry) cleanupFrontends(ctx context.Context) error {
+	prefix := fmt.Sprintf(serversFmt, r.cfg.Namespace, r.backendSpec.AppName)
+	resp, err := r.client.Get(ctx, prefix, etcd.WithPrefix(), etcd.WithCountOnly())
+	if err != nil {
+		return errors.Wrapf(err, "failed to count servers, %s", prefix)
+	}
+	if resp.Count > 0 {
+		return nil
+	}
+
+	switch r.cfg.Cleanup {
+	case CleanupDelete:
+		for _, fes := range r.frontendSpecs {
+			key := fmt.Sprintf(frontendDirFmt, r.cfg.Namespace, fes.Host, fes.ID)
+			if _, err := r.client.Delete(ctx, key, etcd.WithPrefix()); err != nil {
+				return errors.Wrapf(err, "failed to delete frontend, %s", key)
+			}
+		}
+		log.Infof("frontends deleted count=%d", len(r.frontendSpecs))
+	case CleanupExpire:
+		grace := r.cfg.CleanupGracePeriod
+		if grace <= 0 {
+			grace = r.cfg.TTL
+		}
+		lease, err := r.client.Grant(ctx, int64(grace.Seconds()))
+		if err != nil {
+			return errors.Wrap(err, "failed to grant a frontend lease")
+		}
+		for _, fes := range r.frontendSpecs {
+			if err := r.putFrontend(ctx, fes, etcd.WithLease(lease.ID)); err != nil {
+				return err
+			}
+		}
+		log.Infof("frontends expire in %v count=%d", grace, len(r.frontendSpecs))
+	}
+	return nil
+}
+
+// frontendOwner returns the name of the app owning the frontend with the spec.
+func frontendOwner(spec []byte) string {
+	var fe struct {
+		BackendId string
+	}
+	json.Unmarshal(spec, &fe)
+	return fe.BackendId
+}
+
+func (r *Registry) tracer() trace.Tracer {
+	if r.cfg.Tracer == nil {
+		return trace.NoopTracer{}
+	}
+	return r.cfg.Tracer
+}
+
+// startSpan starts a span of an etcd operation on the object with the ID, as a child of the span of
+// the registration in progress if any. It must be called with mu held.
+func (r *Registry) startSpan(name, id string) trace.Span {
+	ctx := r.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := r.tracer().Start(ctx, name, trace.SpanKindClient)
+	span.SetAttribute("vulcand.id", id)
+	return span
+}
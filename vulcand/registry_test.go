@@ -3,6 +3,7 @@ package vulcand
 import (
 	"context"
 	"crypto/tls"
+	"sync"
 	"testing"
 	"time"
 
@@ -166,6 +167,27 @@ func (s *RegistrySuite) TestHeartbeatStop() {
 	s.Equal(len(res.Kvs), 0)
 }
 
+// Stop may be called concurrently, e.g. by a signal handler while the app drains, and again after.
+func (s *RegistrySuite) TestConcurrentStop() {
+	// When
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.r.Stop()
+		}()
+	}
+	wg.Wait()
+	s.r.Stop()
+
+	// Then
+	s.Equal(s.r.getStatus(), int32(stopped))
+	res, err := s.client.Get(s.ctx, testNamespace+"/backends/app1/servers", etcd.WithPrefix())
+	s.Require().Nil(err)
+	s.Equal(len(res.Kvs), 0)
+}
+
 func (s *RegistrySuite) TestHeartbeatNetworkTimeout() {
 	res, err := s.client.Get(s.ctx, testNamespace+"/backends/app1/servers", etcd.WithPrefix())
 	s.Require().Nil(err)
@@ -193,3 +215,201 @@ func (s *RegistrySuite) TestHeartbeatNetworkTimeout() {
 	s.Equal(res.Kvs[0].Lease, int64(s.r.leaseID))
 	s.NotEqual(s.r.leaseID, prevLease)
 }
+
+// Frontends of the app that it no longer declares and their middlewares are removed on start, along
+// with the middlewares that the declared frontends no longer have.
+func (s *RegistrySuite) TestRemoveStaleFrontends() {
+	m := []Middleware{{Type: "bar", ID: "bazz", Spec: "blah"}, {Type: "bar", ID: "gone", Spec: "blah"}}
+	for _, fes := range []*frontendSpec{
+		newFrontendSpec("app2", "host", "/old", []string{"GET"}, m),
+		newFrontendSpec("app2", "host", "/new", []string{"GET"}, m),
+		newFrontendSpec("app3", "host", "/other", []string{"GET"}, nil),
+	} {
+		s.Require().Nil(s.r.registerFrontend(fes))
+	}
+	r, err := NewRegistry(s.cfg, "app2", "192.168.19.3", 8000)
+	s.Require().Nil(err)
+	r.AddFrontend("host", "/new", []string{"GET"}, m[:1])
+
+	// When
+	err = r.Start()
+	defer r.Stop()
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(s.frontendKeys(), []string{
+		testNamespace + "/frontends/host.get.new/frontend",
+		testNamespace + "/frontends/host.get.new/middlewares/bazz",
+		testNamespace + "/frontends/host.get.other/frontend",
+	})
+}
+
+// Frontends declared by another instance of the app, e.g. of a newer version being deployed, survive
+// when an instance reconnects to etcd.
+func (s *RegistrySuite) TestReconnectKeepsFrontends() {
+	r1, err := NewRegistry(s.cfg, "app2", "192.168.19.3", 8001)
+	s.Require().Nil(err)
+	r1.AddFrontend("host", "/old", []string{"GET"}, nil)
+	s.Require().Nil(r1.Start())
+	defer r1.Stop()
+	r2, err := NewRegistry(s.cfg, "app2", "192.168.19.4", 8002)
+	s.Require().Nil(err)
+	r2.AddFrontend("host", "/new", []string{"GET"}, nil)
+	s.Require().Nil(r2.Start())
+	defer r2.Stop()
+	s.Require().Nil(r2.AddFrontend("host", "/runtime", []string{"GET"}, nil))
+
+	// When
+	err = r1.connectAndRegister(false)
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(s.frontendKeys(), []string{
+		testNamespace + "/frontends/host.get.new/frontend",
+		testNamespace + "/frontends/host.get.old/frontend",
+		testNamespace + "/frontends/host.get.runtime/frontend",
+	})
+
+	// When
+	err = r1.AddFrontend("host", "/old", []string{"GET"}, []Middleware{{Type: "bar", ID: "bazz", Spec: "blah"}})
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(len(s.frontendKeys()), 4)
+}
+
+// During a rolling deploy an instance of the old version that restarts keeps the frontends and the
+// middlewares that the instances of the new version declare.
+func (s *RegistrySuite) TestRestartKeepsDeclaredFrontends() {
+	m := []Middleware{{Type: "bar", ID: "bazz", Spec: "blah"}, {Type: "bar", ID: "new", Spec: "blah"}}
+	r1, err := NewRegistry(s.cfg, "app2", "192.168.19.3", 8001)
+	s.Require().Nil(err)
+	r1.AddFrontend("host", "/old", []string{"GET"}, nil)
+	r1.AddFrontend("host", "/shared", []string{"GET"}, m[:1])
+	s.Require().Nil(r1.Start())
+	r2, err := NewRegistry(s.cfg, "app2", "192.168.19.4", 8002)
+	s.Require().Nil(err)
+	r2.AddFrontend("host", "/new", []string{"GET"}, nil)
+	r2.AddFrontend("host", "/shared", []string{"GET"}, m)
+	s.Require().Nil(r2.Start())
+	defer r2.Stop()
+
+	// When
+	r1.Stop()
+	r1, err = NewRegistry(s.cfg, "app2", "192.168.19.3", 8001)
+	s.Require().Nil(err)
+	r1.AddFrontend("host", "/old", []string{"GET"}, nil)
+	r1.AddFrontend("host", "/shared", []string{"GET"}, m[:1])
+	err = r1.Start()
+	defer r1.Stop()
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(s.frontendKeys(), []string{
+		testNamespace + "/frontends/host.get.new/frontend",
+		testNamespace + "/frontends/host.get.old/frontend",
+		testNamespace + "/frontends/host.get.shared/frontend",
+		testNamespace + "/frontends/host.get.shared/middlewares/bazz",
+		testNamespace + "/frontends/host.get.shared/middlewares/new",
+	})
+
+	// When
+	err = r1.RemoveFrontend("host", "/shared", []string{"GET"})
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(len(s.frontendKeys()), 5)
+}
+
+// Frontends are deleted when the last instance of the app deregisters.
+func (s *RegistrySuite) TestCleanupDelete() {
+	cfg := s.cfg
+	cfg.Cleanup = CleanupDelete
+	r1 := s.newAppRegistry(cfg, 8001)
+	r2 := s.newAppRegistry(cfg, 8002)
+	s.Equal(len(s.frontendKeys()), 1)
+
+	// When
+	r1.Stop()
+
+	// Then
+	s.Equal(len(s.frontendKeys()), 1)
+
+	// When
+	r2.Stop()
+
+	// Then
+	s.Equal(len(s.frontendKeys()), 0)
+}
+
+// Frontends expire after the grace period when the last instance of the app deregisters.
+func (s *RegistrySuite) TestCleanupExpire() {
+	cfg := s.cfg
+	cfg.Cleanup = CleanupExpire
+	cfg.CleanupGracePeriod = 2 * time.Second
+	r := s.newAppRegistry(cfg, 8001)
+
+	// When
+	r.Stop()
+
+	// Then
+	res, err := s.client.Get(s.ctx, testNamespace+"/frontends/host.get.path.to.server/frontend")
+	s.Require().Nil(err)
+	s.Require().Equal(len(res.Kvs), 1)
+	s.NotEqual(res.Kvs[0].Lease, int64(0))
+
+	<-time.After(time.Second * 4)
+	s.Equal(len(s.frontendKeys()), 0)
+}
+
+func (s *RegistrySuite) newAppRegistry(cfg Config, port int) *Registry {
+	r, err := NewRegistry(cfg, "app2", "192.168.19.3", port)
+	s.Require().Nil(err)
+	r.AddFrontend("host", "/path/to/server", []string{"GET"}, nil)
+	s.Require().Nil(r.Start())
+	return r
+}
+
+func (s *RegistrySuite) frontendKeys() []string {
+	res, err := s.client.Get(s.ctx, testNamespace+"/frontends/", etcd.WithPrefix(), etcd.WithKeysOnly())
+	s.Require().Nil(err)
+	keys := make([]string, len(res.Kvs))
+	for i, kv := range res.Kvs {
+		keys[i] = string(kv.Key)
+	}
+	return keys
+}
+
+// Frontends added and removed while the registry is running are written and deleted right away.
+func (s *RegistrySuite) TestRuntimeFrontends() {
+	m := []Middleware{{Type: "bar", ID: "bazz", Spec: "blah"}, {Type: "bar", ID: "gone", Spec: "blah"}}
+
+	// When
+	err := s.r.AddFrontend("host", "/path/to/server", []string{"GET"}, m)
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(s.frontendKeys(), []string{
+		testNamespace + "/frontends/host.get.path.to.server/frontend",
+		testNamespace + "/frontends/host.get.path.to.server/middlewares/bazz",
+		testNamespace + "/frontends/host.get.path.to.server/middlewares/gone",
+	})
+
+	// When
+	err = s.r.AddFrontend("host", "/path/to/server", []string{"GET"}, m[:1])
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(s.frontendKeys(), []string{
+		testNamespace + "/frontends/host.get.path.to.server/frontend",
+		testNamespace + "/frontends/host.get.path.to.server/middlewares/bazz",
+	})
+
+	// When
+	err = s.r.RemoveFrontend("host", "/path/to/server", []string{"GET"})
+
+	// Then
+	s.Require().Nil(err)
+	s.Equal(len(s.frontendKeys()), 0)
+	s.NotNil(s.r.RemoveFrontend("host", "/path/to/server", []string{"GET"}))
+}